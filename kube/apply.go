@@ -0,0 +1,242 @@
+package kube
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// LastAppliedAnnotation keeps the last applied configuration of objects applied by
+// ClientSideApply. It's the same one used by kubectl apply.
+const LastAppliedAnnotation = corev1.LastAppliedConfigAnnotation
+
+// ApplyResult is the result of ClientSideApply.
+type ApplyResult struct {
+	// Created is true if the object didn't exist and is created.
+	Created bool
+	// Changed are the paths of the changed fields, e.g. spec.replicas.
+	Changed []string
+}
+
+// normalizedJSON returns the JSON of the object as a map with the type meta set, and
+// without status, null values, server managed metadata and the last applied annotation.
+func normalizedJSON(obj client.Object, gvk schema.GroupVersionKind) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	m["apiVersion"], m["kind"] = gvk.GroupVersion().String(), gvk.Kind
+	delete(m, "status")
+	if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+		for _, k := range []string{"managedFields", "resourceVersion", "uid", "generation", "creationTimestamp", "selfLink"} {
+			delete(metadata, k)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, LastAppliedAnnotation)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+	pruneNulls(m)
+	return m, nil
+}
+
+// setLastApplied sets the last applied annotation of the normalized JSON.
+func setLastApplied(m map[string]interface{}, lastApplied string) {
+	if lastApplied == "" {
+		return
+	}
+	metadata, ok := m["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		m["metadata"] = metadata
+	}
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		annotations = map[string]interface{}{}
+		metadata["annotations"] = annotations
+	}
+	annotations[LastAppliedAnnotation] = lastApplied
+}
+
+// changedFields returns the paths of the fields in the patch, skipping the directives
+// of strategic merge patches and the last applied annotation.
+func changedFields(patch map[string]interface{}, prefix string, fields []string) []string {
+	for k, v := range patch {
+		if strings.HasPrefix(k, "$") {
+			continue
+		}
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if path == "metadata.annotations."+LastAppliedAnnotation {
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			fields = changedFields(m, path, fields)
+			continue
+		}
+		fields = append(fields, path)
+	}
+	return fields
+}
+
+// threeWayPatch computes the patch from the last applied, the desired and the live
+// configurations. Strategic merge patches are used for the built-in kinds, and JSON
+// merge patches are used for others, e.g. the custom resources.
+func threeWayPatch(gvk schema.GroupVersionKind, original, modified, current []byte) (client.Patch, []byte, error) {
+	if clientgoscheme.Scheme.Recognizes(gvk) {
+		versioned, err := clientgoscheme.Scheme.New(gvk)
+		if err != nil {
+			return nil, nil, err
+		}
+		meta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, meta, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client.RawPatch(types.StrategicMergePatchType, data), data, nil
+	}
+
+	data, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.RawPatch(types.MergePatchType, data), data, nil
+}
+
+// ClientSideApply applies the object with a three-way merge like kubectl apply, which
+// works for any kinds, including the custom resources and unstructured objects. The last
+// applied configuration is kept in the LastAppliedAnnotation, so the fields removed from
+// the object since the last apply are removed, while the fields set by others are kept.
+// The object is created if it doesn't exist. The writes are sent with the field owner of
+// the context, and the object is updated with the server state, e.g. the UID and the
+// resource version, like the other writes.
+func ClientSideApply(rc ReconcileContext, object client.Object) (*ApplyResult, error) {
+	gvk, err := apiutil.GVKForObject(object, rc.Scheme())
+	if err != nil {
+		return nil, err
+	}
+
+	live := reflect.New(reflect.TypeOf(object).Elem()).Interface().(client.Object)
+	if u, ok := live.(*unstructured.Unstructured); ok {
+		u.SetGroupVersionKind(gvk)
+	}
+	if err := rc.Client().Get(rc.Context(), client.ObjectKeyFromObject(object), live); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		live = nil
+	}
+	return clientSideApply(rc, object, live)
+}
+
+// clientSideApply applies the object against the live one like ClientSideApply, and
+// creates it if the live one is nil.
+func clientSideApply(rc ReconcileContext, object client.Object, live client.Object) (*ApplyResult, error) {
+	gvk, err := apiutil.GVKForObject(object, rc.Scheme())
+	if err != nil {
+		return nil, err
+	}
+
+	desired, err := normalizedJSON(object, gvk)
+	if err != nil {
+		return nil, err
+	}
+	lastApplied, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+	// The annotation is set on a copy, which is filled with the server state and then
+	// copied back to the object.
+	applied := object.DeepCopyObject().(client.Object)
+	annotations := applied.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedAnnotation] = string(lastApplied)
+	applied.SetAnnotations(annotations)
+
+	if live == nil {
+		if err := rc.Client().Create(rc.Context(), applied, rc.Owner()); err != nil {
+			return nil, err
+		}
+		setObject(object, applied, gvk)
+		return &ApplyResult{Created: true}, nil
+	}
+
+	// The live object keeps the fields managed by others.
+	current, err := normalizedJSON(live, gvk)
+	if err != nil {
+		return nil, err
+	}
+	setLastApplied(current, live.GetAnnotations()[LastAppliedAnnotation])
+	currentData, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	setLastApplied(desired, string(lastApplied))
+	modifiedData, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+	original := []byte(live.GetAnnotations()[LastAppliedAnnotation])
+	if len(original) == 0 {
+		original = []byte("{}")
+	}
+
+	patch, data, err := threeWayPatch(gvk, original, modifiedData, currentData)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	result := &ApplyResult{Changed: changedFields(m, "", nil)}
+	sort.Strings(result.Changed)
+	if len(m) == 0 {
+		setObject(object, live, gvk)
+		return result, nil
+	}
+	if err := rc.Client().Patch(rc.Context(), applied, patch, rc.Owner()); err != nil {
+		return nil, err
+	}
+	setObject(object, applied, gvk)
+	return result, nil
+}
+
+// setObject copies the server state in src to dst of the same type, keeping the kind.
+func setObject(dst, src client.Object, gvk schema.GroupVersionKind) {
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src.DeepCopyObject()).Elem())
+	dst.GetObjectKind().SetGroupVersionKind(gvk)
+}
+
+// isUnstructured returns true if the object is an unstructured one.
+func isUnstructured(object client.Object) bool {
+	_, ok := object.(runtime.Unstructured)
+	return ok
+}
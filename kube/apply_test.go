@@ -0,0 +1,98 @@
+package kube_test
+
+import (
+	"testing"
+
+	"github.com/sqc157400661/helper/kube"
+	"github.com/sqc157400661/helper/kube/kubetest"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestClientSideApplyTyped(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "pdb"))
+	desired := func(labels map[string]string, minAvailable int) *policyv1.PodDisruptionBudget {
+		min := intstr.FromInt(minAvailable)
+		return &policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: "pdb", Namespace: "default", Labels: labels},
+			Spec:       policyv1.PodDisruptionBudgetSpec{MinAvailable: &min},
+		}
+	}
+
+	pdb := desired(map[string]string{"a": "1", "b": "2"}, 1)
+	result, err := kube.ClientSideApply(rc, pdb)
+	assert.NoError(t, err)
+	assert.True(t, result.Created)
+	assert.NotEmpty(t, pdb.ResourceVersion, "object is not updated with the server state")
+
+	// Labels set by others are kept.
+	live := &policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: "pdb", Namespace: "default"}}
+	assert.NoError(t, rc.Get(live))
+	live.Labels["others"] = "x"
+	assert.NoError(t, rc.Client().Update(rc.Context(), live))
+
+	result, err = kube.ClientSideApply(rc, desired(map[string]string{"a": "1"}, 2))
+	assert.NoError(t, err)
+	assert.False(t, result.Created)
+	assert.Equal(t, []string{"metadata.labels.b", "spec.minAvailable"}, result.Changed)
+
+	assert.NoError(t, rc.Get(live))
+	assert.Equal(t, map[string]string{"a": "1", "others": "x"}, live.Labels)
+	assert.Equal(t, 2, live.Spec.MinAvailable.IntValue())
+
+	// Nothing changes when applied again.
+	result, err = kube.ClientSideApply(rc, desired(map[string]string{"a": "1"}, 2))
+	assert.NoError(t, err)
+	assert.Empty(t, result.Changed)
+
+	// Applied against the old object passed.
+	pdb = desired(map[string]string{"a": "2"}, 2)
+	assert.NoError(t, rc.CSAApply(pdb, live))
+	assert.NoError(t, rc.Get(live))
+	assert.Equal(t, map[string]string{"a": "2", "others": "x"}, live.Labels)
+	assert.Equal(t, live.ResourceVersion, pdb.ResourceVersion)
+}
+
+func TestCSAApplyBuiltinKinds(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "cm"))
+	desired := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}, Data: data}
+	}
+
+	cm := desired(map[string]string{"a": "1", "b": "2"})
+	assert.NoError(t, rc.CSAApply(cm))
+	assert.Contains(t, cm.Annotations, kube.LastAppliedAnnotation)
+
+	// The keys removed since the last apply are removed.
+	cm = desired(map[string]string{"a": "1"})
+	assert.NoError(t, rc.CSAApply(cm))
+	live := desired(nil)
+	assert.NoError(t, rc.Get(live))
+	assert.Equal(t, map[string]string{"a": "1"}, live.Data)
+	assert.Equal(t, live.ResourceVersion, cm.ResourceVersion)
+}
+
+func TestClientSideApplyUnstructured(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "db"))
+	desired := func(spec map[string]interface{}) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		u.SetAPIVersion("example.com/v1")
+		u.SetKind("Database")
+		u.SetNamespace("default")
+		u.SetName("db")
+		return u
+	}
+
+	assert.NoError(t, rc.CSAApply(desired(map[string]interface{}{"replicas": int64(1), "engine": "mysql"})))
+	assert.NoError(t, rc.CSAApply(desired(map[string]interface{}{"replicas": int64(3)})))
+
+	live := desired(nil)
+	assert.NoError(t, rc.Get(live))
+	spec, _, _ := unstructured.NestedMap(live.Object, "spec")
+	assert.Equal(t, map[string]interface{}{"replicas": int64(3)}, spec)
+	assert.Contains(t, live.GetAnnotations(), kube.LastAppliedAnnotation)
+}
@@ -2,6 +2,7 @@ package kube
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/go-logr/logr"
 
@@ -29,7 +30,7 @@ func (s *stepIf) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, erro
 }
 
 func (s *stepIf) executeIf(rc ReconcileContext, flow Flow, cond Condition) (reconcile.Result, error) {
-	condVal, err := cond.Evaluate(rc, flow.Logger())
+	condVal, err := evaluate(rc, flow, cond)
 	if err != nil {
 		return flow.Error(err, "Evaluate condition failed.")
 	}
@@ -98,3 +99,154 @@ func NewCachedCondition(cond Condition) Condition {
 		result: nil,
 	}
 }
+
+type combinedCond struct {
+	op    string
+	conds []Condition
+}
+
+func (c *combinedCond) Name() string {
+	names := make([]string, 0, len(c.conds))
+	for _, cond := range c.conds {
+		names = append(names, cond.Name())
+	}
+	return c.op + "(" + strings.Join(names, ",") + ")"
+}
+
+func (c *combinedCond) Evaluate(rc ReconcileContext, log logr.Logger) (bool, error) {
+	switch c.op {
+	case "And":
+		for _, cond := range c.conds {
+			if val, err := cond.Evaluate(rc, log); err != nil || !val {
+				return false, err
+			}
+		}
+		return true, nil
+	case "Or":
+		for _, cond := range c.conds {
+			if val, err := cond.Evaluate(rc, log); err != nil || val {
+				return val, err
+			}
+		}
+		return false, nil
+	default:
+		val, err := c.conds[0].Evaluate(rc, log)
+		return !val && err == nil, err
+	}
+}
+
+// And returns a condition which is true if all the conditions are true. The conditions
+// are evaluated in order and it stops at the first false.
+func And(conds ...Condition) Condition {
+	return &combinedCond{op: "And", conds: conds}
+}
+
+// Or returns a condition which is true if any of the conditions is true. The conditions
+// are evaluated in order and it stops at the first true.
+func Or(conds ...Condition) Condition {
+	return &combinedCond{op: "Or", conds: conds}
+}
+
+// Not returns a condition which negates the given one.
+func Not(cond Condition) Condition {
+	return &combinedCond{op: "Not", conds: []Condition{cond}}
+}
+
+// evaluate evaluates the condition and traces it in the flow.
+func evaluate(rc ReconcileContext, flow Flow, cond Condition) (bool, error) {
+	endTrace := traceCondition(flow, cond.Name())
+	val, err := cond.Evaluate(rc, flow.Logger())
+	endTrace(val, err)
+	return val, err
+}
+
+type stepIfElse struct {
+	cond        Condition
+	thenBinders []BindFunc
+	elseBinders []BindFunc
+}
+
+func (s *stepIfElse) Name() string {
+	return "StepIfElse-" + s.cond.Name()
+}
+
+func (s *stepIfElse) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	condVal, err := evaluate(rc, flow, s.cond)
+	if err != nil {
+		return flow.Error(err, "Evaluate condition failed.")
+	}
+
+	if condVal {
+		flow.Logger().Info("Condition matches, execute then branch.")
+		return executeBlock(rc, flow, ExtractStepsFromBindFunc(s.thenBinders...), "step-if")
+	}
+	flow.Logger().Info("Condition not matches, execute else branch.")
+	return executeBlock(rc, flow, ExtractStepsFromBindFunc(s.elseBinders...), "step-else")
+}
+
+// StepIfElse evaluates the condition when executed, and then executes the steps of the
+// then binders or the else binders in order. The branches are bound lazily, so they
+// could depend on the states produced by previous steps.
+func StepIfElse(cond Condition, thenBinders, elseBinders []BindFunc) BindFunc {
+	return NewStepBinder(&stepIfElse{
+		cond:        cond,
+		thenBinders: thenBinders,
+		elseBinders: elseBinders,
+	})
+}
+
+// SwitchCase is a case of Switch.
+type SwitchCase struct {
+	cond    Condition
+	binders []BindFunc
+}
+
+// Case returns a case executing the steps of binders when the condition is true.
+func Case(cond Condition, binders ...BindFunc) SwitchCase {
+	return SwitchCase{cond: cond, binders: binders}
+}
+
+// Default returns a case which always matches.
+func Default(binders ...BindFunc) SwitchCase {
+	return SwitchCase{binders: binders}
+}
+
+type switchStep struct {
+	cases []SwitchCase
+}
+
+func (s *switchStep) Name() string {
+	names := make([]string, 0, len(s.cases))
+	for _, c := range s.cases {
+		if c.cond == nil {
+			names = append(names, "Default")
+		} else {
+			names = append(names, c.cond.Name())
+		}
+	}
+	return "Switch(" + strings.Join(names, ",") + ")"
+}
+
+func (s *switchStep) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	for i, c := range s.cases {
+		if c.cond != nil {
+			condVal, err := evaluate(rc, flow, c.cond)
+			if err != nil {
+				return flow.Error(err, "Evaluate condition failed.", "case", i)
+			}
+			if !condVal {
+				continue
+			}
+		}
+
+		flow.Logger().Info("Case matches.", "case", i)
+		return executeBlock(rc, flow, ExtractStepsFromBindFunc(c.binders...), "switch-case")
+	}
+	return flow.Pass()
+}
+
+// Switch evaluates the conditions of the cases in order when executed, and executes the
+// steps of the first matched case. The cases are bound lazily, see StepIfElse.
+func Switch(cases ...SwitchCase) BindFunc {
+	return NewStepBinder(&switchStep{cases: cases})
+}
@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func constCond(name string, val bool) Condition {
+	return NewCondition(name, func(rc ReconcileContext, log logr.Logger) (bool, error) {
+		return val, nil
+	})
+}
+
+func TestConditionCombinators(t *testing.T) {
+	yes, no := constCond("yes", true), constCond("no", false)
+	broken := NewCondition("broken", func(rc ReconcileContext, log logr.Logger) (bool, error) {
+		return false, errors.New("broken")
+	})
+
+	for _, c := range []struct {
+		cond Condition
+		val  bool
+		err  bool
+	}{
+		{cond: And(yes, yes), val: true},
+		{cond: And(yes, no, broken), val: false},
+		{cond: And(yes, broken), err: true},
+		{cond: Or(no, yes, broken), val: true},
+		{cond: Or(no, no), val: false},
+		{cond: Or(no, broken), err: true},
+		{cond: Not(no), val: true},
+		{cond: Not(And(yes, Or(no, yes))), val: false},
+		{cond: Not(broken), err: true},
+	} {
+		val, err := c.cond.Evaluate(nil, logr.Discard())
+		if c.err {
+			assert.Error(t, err, c.cond.Name())
+		} else {
+			assert.NoError(t, err, c.cond.Name())
+			assert.Equal(t, c.val, val, c.cond.Name())
+		}
+	}
+	assert.Equal(t, "Not(And(yes,Or(no,yes)))", Not(And(yes, Or(no, yes))).Name())
+}
+
+func TestStepIfElseAndSwitchAreLazy(t *testing.T) {
+	r := &recorder{}
+	state := 0
+	setState := NewStepBinder(NewStep("set", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		state = 2
+		return flow.Pass()
+	}))
+	stateIs := func(v int) Condition {
+		return NewCondition("state", func(rc ReconcileContext, log logr.Logger) (bool, error) {
+			return state == v, nil
+		})
+	}
+
+	_, err := runTestTask(
+		setState,
+		StepIfElse(stateIs(2),
+			[]BindFunc{r.step("then-1"), func(t *Task, deferred ...bool) {
+				When(state == 0, r.step("then-2"))(t, deferred...)
+			}},
+			[]BindFunc{r.step("else")},
+		),
+		Switch(
+			Case(stateIs(1), r.step("case-1")),
+			Case(stateIs(2), r.step("case-2"), Wait("wait"), r.step("unreachable")),
+			Default(r.step("default")),
+		),
+		r.step("after"),
+	)
+	assert.NoError(t, err)
+	// Binders of the branches are bound lazily, when state is 2.
+	assert.Equal(t, []string{"then-1", "case-2"}, r.steps)
+
+	r.steps = nil
+	_, err = runTestTask(Switch(Case(stateIs(1), r.step("case-1")), Default(r.step("default"))))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default"}, r.steps)
+}
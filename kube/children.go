@@ -0,0 +1,253 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// InventoryLabel marks the children reconciled by ReconcileChildren with the UID of
+	// their owner.
+	InventoryLabel = "helper.kube.io/inventory"
+	// KeepAnnotation prevents the children from being pruned when set to "true".
+	KeepAnnotation = "helper.kube.io/keep"
+	// InventoryKindsAnnotation records the kinds of the children reconciled by
+	// ReconcileChildren on the owner, e.g. "v1/ConfigMap,apps/v1/Deployment", so the
+	// kinds no longer desired are still pruned. It isn't recorded with PruneKinds.
+	InventoryKindsAnnotation = "helper.kube.io/inventory-kinds"
+)
+
+// formatKinds formats the kinds in the InventoryKindsAnnotation.
+func formatKinds(kinds map[schema.GroupVersionKind]bool) string {
+	items := make([]string, 0, len(kinds))
+	for gvk := range kinds {
+		items = append(items, gvk.GroupVersion().String()+"/"+gvk.Kind)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// parseKinds parses the kinds in the InventoryKindsAnnotation.
+func parseKinds(value string) []schema.GroupVersionKind {
+	var kinds []schema.GroupVersionKind
+	for _, item := range strings.Split(value, ",") {
+		i := strings.LastIndex(item, "/")
+		if i <= 0 || i == len(item)-1 {
+			continue
+		}
+		kinds = append(kinds, schema.FromAPIVersionAndKind(item[:i], item[i+1:]))
+	}
+	return kinds
+}
+
+// ChildrenFunc returns the desired children of the owner.
+type ChildrenFunc func(rc ReconcileContext) ([]client.Object, error)
+
+type childrenOptions struct {
+	pruneKinds []schema.GroupVersionKind
+	csa        bool
+}
+
+// ChildrenOption configures ReconcileChildren.
+type ChildrenOption func(o *childrenOptions)
+
+// PruneKinds sets the only kinds to prune, instead of the kinds of the desired children
+// and the ones recorded in the InventoryKindsAnnotation of the owner. The owner isn't
+// annotated then, so it isn't updated when the kinds of the children change.
+func PruneKinds(gvks ...schema.GroupVersionKind) ChildrenOption {
+	return func(o *childrenOptions) {
+		o.pruneKinds = append(o.pruneKinds, gvks...)
+	}
+}
+
+// WithClientSideApply applies the children with rc.CSAApply instead of rc.Apply, for
+// servers not supporting server-side apply.
+func WithClientSideApply() ChildrenOption {
+	return func(o *childrenOptions) {
+		o.csa = true
+	}
+}
+
+type childKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+type reconcileChildren struct {
+	owner    client.Object
+	children ChildrenFunc
+	options  childrenOptions
+}
+
+func (s *reconcileChildren) Name() string {
+	return "ReconcileChildren"
+}
+
+func (s *reconcileChildren) apply(rc ReconcileContext, child client.Object) error {
+	if s.options.csa {
+		return rc.CSAApply(child)
+	}
+	return rc.Apply(child)
+}
+
+func (s *reconcileChildren) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	children, err := s.children(rc)
+	if err != nil {
+		return flow.Error(err, "Failed to build children.")
+	}
+
+	if s.owner.GetUID() == "" {
+		return flow.Error(errors.New("owner has no UID, it should be loaded before"), "Invalid owner.")
+	}
+
+	inventory := string(s.owner.GetUID())
+	desired := make(map[childKey]bool, len(children))
+	kinds := make(map[schema.GroupVersionKind]bool)
+	for _, child := range children {
+		gvk, err := apiutil.GVKForObject(child, rc.Scheme())
+		if err != nil {
+			return flow.Error(err, "Failed to get kind of child.", "name", child.GetName())
+		}
+		// Apply patches need the type meta.
+		child.GetObjectKind().SetGroupVersionKind(gvk)
+
+		childLabels := child.GetLabels()
+		if childLabels == nil {
+			childLabels = map[string]string{}
+		}
+		childLabels[InventoryLabel] = inventory
+		child.SetLabels(childLabels)
+		if err := controllerutil.SetControllerReference(s.owner, child, rc.Scheme()); err != nil {
+			return flow.Error(err, "Failed to set owner reference.", "kind", gvk.Kind, "name", child.GetName())
+		}
+
+		if err := s.apply(rc, child); err != nil {
+			return flow.Error(err, "Failed to apply child.", "kind", gvk.Kind, "name", child.GetName())
+		}
+		desired[childKey{gvk: gvk, namespace: child.GetNamespace(), name: child.GetName()}] = true
+		kinds[gvk] = true
+	}
+
+	pruneKinds := make(map[schema.GroupVersionKind]bool, len(kinds))
+	if len(s.options.pruneKinds) > 0 {
+		for _, gvk := range s.options.pruneKinds {
+			pruneKinds[gvk] = true
+		}
+	} else {
+		for gvk := range kinds {
+			pruneKinds[gvk] = true
+		}
+		for _, gvk := range parseKinds(s.owner.GetAnnotations()[InventoryKindsAnnotation]) {
+			pruneKinds[gvk] = true
+		}
+	}
+
+	pruned, err := s.prune(rc, inventory, pruneKinds, desired)
+	if len(pruned) > 0 {
+		flow.Logger().Info("Pruned children.", "children", strings.Join(pruned, ", "))
+	}
+	if err != nil {
+		return flow.Error(err, "Failed to prune children.")
+	}
+	if len(s.options.pruneKinds) > 0 {
+		return flow.Pass()
+	}
+
+	// Only the kinds desired are left after pruning.
+	err = patchMetadata(rc, s.owner, func() bool {
+		annotations := s.owner.GetAnnotations()
+		recorded := formatKinds(kinds)
+		if annotations[InventoryKindsAnnotation] == recorded {
+			return false
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		if recorded == "" {
+			delete(annotations, InventoryKindsAnnotation)
+		} else {
+			annotations[InventoryKindsAnnotation] = recorded
+		}
+		s.owner.SetAnnotations(annotations)
+		return true
+	})
+	if err != nil {
+		return flow.RetryErr(err, "Failed to record kinds of children.")
+	}
+	return flow.Pass()
+}
+
+// prune deletes the children of the kinds in the inventory but not desired, and returns
+// the pruned ones.
+func (s *reconcileChildren) prune(rc ReconcileContext, inventory string, kinds map[schema.GroupVersionKind]bool, desired map[childKey]bool) ([]string, error) {
+	selector := labels.SelectorFromSet(labels.Set{InventoryLabel: inventory})
+
+	sorted := make([]schema.GroupVersionKind, 0, len(kinds))
+	for gvk := range kinds {
+		sorted = append(sorted, gvk)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+
+	pruned := make([]string, 0)
+	for _, gvk := range sorted {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := rc.List(list, selector); err != nil {
+			return pruned, err
+		}
+
+		for i := range list.Items {
+			item := &list.Items[i]
+			if desired[childKey{gvk: gvk, namespace: item.GetNamespace(), name: item.GetName()}] {
+				continue
+			}
+			if item.GetAnnotations()[KeepAnnotation] == "true" {
+				continue
+			}
+			// Never touch the ones controlled by others.
+			if ref := metav1.GetControllerOf(item); ref == nil || ref.UID != s.owner.GetUID() {
+				continue
+			}
+
+			err := rc.Client().Delete(rc.Context(), item, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if client.IgnoreNotFound(err) != nil {
+				return pruned, err
+			}
+			pruned = append(pruned, fmt.Sprintf("%s %s", gvk.Kind, item.GetName()))
+		}
+	}
+	return pruned, nil
+}
+
+// ReconcileChildren reconciles the set of the children of the owner, which should be
+// loaded by the previous steps. Each desired child is labeled with the InventoryLabel,
+// controlled by the owner and then applied. After that, the children in the owner's
+// namespace labeled and controlled but no longer desired are deleted, except the ones
+// annotated with KeepAnnotation. The kinds of the children are recorded on the owner with
+// the InventoryKindsAnnotation, so the kinds no longer desired, even if no children are
+// desired at all, are pruned too. Patching the annotation updates the owner, which
+// triggers another reconcile when the kinds change unless the watch of the owner filters
+// the metadata changes, e.g. with predicate.GenerationChangedPredicate. Only the kinds set
+// by PruneKinds are pruned if any, and the owner isn't annotated then. It fails if the
+// owner has no UID.
+func ReconcileChildren(owner client.Object, children ChildrenFunc, opts ...ChildrenOption) BindFunc {
+	s := &reconcileChildren{owner: owner, children: children}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	return NewStepBinder(s)
+}
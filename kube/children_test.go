@@ -0,0 +1,117 @@
+package kube_test
+
+import (
+	"testing"
+
+	"github.com/sqc157400661/helper/kube"
+	"github.com/sqc157400661/helper/kube/kubetest"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileChildren(t *testing.T) {
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "default", UID: "owner-uid"}}
+	child := func(name string, ownerUID types.UID, annotations map[string]string) client.Object {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "default", Annotations: annotations,
+			Labels: map[string]string{kube.InventoryLabel: "owner-uid"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: ownerUID, Controller: pointer.Bool(true),
+			}},
+		}}
+	}
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(owner,
+		child("stale", "owner-uid", nil),
+		child("kept", "owner-uid", map[string]string{kube.KeepAnnotation: "true"}),
+		child("others", "other-uid", nil),
+	))
+
+	kubetest.Run(t, rc, kube.ReconcileChildren(owner, func(rc kube.ReconcileContext) ([]client.Object, error) {
+		return []client.Object{
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "desired", Namespace: "default"}},
+		}, nil
+	}, kube.WithClientSideApply())).ExpectContinue()
+
+	desired := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "desired", Namespace: "default"}}
+	assert.NoError(t, rc.Get(desired))
+	assert.Equal(t, "owner-uid", desired.Labels[kube.InventoryLabel])
+	assert.Equal(t, types.UID("owner-uid"), metav1.GetControllerOf(desired).UID)
+
+	for name, exists := range map[string]bool{"stale": false, "kept": true, "others": true} {
+		err := rc.Get(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})
+		if exists {
+			assert.NoError(t, err, name)
+		} else {
+			assert.True(t, apierrors.IsNotFound(err), name)
+		}
+	}
+}
+
+func TestReconcileChildrenPrunesDroppedKinds(t *testing.T) {
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "default", UID: "owner-uid"}}
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(owner))
+
+	var children []client.Object
+	reconcileChildren := kube.ReconcileChildren(owner, func(rc kube.ReconcileContext) ([]client.Object, error) {
+		return children, nil
+	}, kube.WithClientSideApply())
+
+	children = []client.Object{
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"}},
+	}
+	kubetest.Run(t, rc, reconcileChildren).ExpectContinue()
+	assert.Equal(t, "v1/ConfigMap,v1/Secret", owner.Annotations[kube.InventoryKindsAnnotation])
+
+	// The kinds no longer desired are pruned.
+	children = []client.Object{
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}},
+	}
+	kubetest.Run(t, rc, reconcileChildren).ExpectContinue()
+	assert.True(t, apierrors.IsNotFound(rc.Get(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"}})))
+	assert.Equal(t, "v1/ConfigMap", owner.Annotations[kube.InventoryKindsAnnotation])
+
+	// Even if no children are desired.
+	children = nil
+	kubetest.Run(t, rc, reconcileChildren).ExpectContinue()
+	assert.True(t, apierrors.IsNotFound(rc.Get(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}})))
+	assert.NotContains(t, owner.Annotations, kube.InventoryKindsAnnotation)
+
+	// Owners not loaded are rejected.
+	kubetest.Run(t, rc, kube.ReconcileChildren(&corev1.ConfigMap{}, func(rc kube.ReconcileContext) ([]client.Object, error) {
+		return nil, nil
+	})).ExpectError()
+}
+
+func TestReconcileChildrenPruneKinds(t *testing.T) {
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "default", UID: "owner-uid"}}
+	child := func(obj client.Object) client.Object {
+		obj.SetNamespace("default")
+		obj.SetLabels(map[string]string{kube.InventoryLabel: "owner-uid"})
+		obj.SetOwnerReferences([]metav1.OwnerReference{{
+			APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: "owner-uid", Controller: pointer.Bool(true),
+		}})
+		return obj
+	}
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(owner,
+		child(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "stale"}}),
+		child(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "stale"}}),
+	))
+
+	kubetest.Run(t, rc, kube.ReconcileChildren(owner, func(rc kube.ReconcileContext) ([]client.Object, error) {
+		return []client.Object{
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "desired", Namespace: "default"}},
+		}, nil
+	}, kube.PruneKinds(corev1.SchemeGroupVersion.WithKind("Secret")), kube.WithClientSideApply())).ExpectContinue()
+
+	// Only the kinds set are pruned, and the owner isn't annotated.
+	assert.True(t, apierrors.IsNotFound(rc.Get(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "stale", Namespace: "default"}})))
+	assert.NoError(t, rc.Get(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "stale", Namespace: "default"}}))
+	assert.NoError(t, rc.Get(owner))
+	assert.NotContains(t, owner.Annotations, kube.InventoryKindsAnnotation)
+}
@@ -6,8 +6,18 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// controlStep is a built-in step ending the flow, e.g. Wait, which is drawn as an end
+// of the path in the diagrams.
+type controlStep struct {
+	step
+}
+
+func newControlStep(name string, f ExecuteFunc) Step {
+	return &controlStep{step: step{name: name, f: f}}
+}
+
 func wait(name, msg string) BindFunc {
-	return NewStepBinder(NewStep(name,
+	return NewStepBinder(newControlStep(name,
 		func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
 			return flow.Wait(msg)
 		}),
@@ -30,7 +40,7 @@ func AbortWhen(cond bool, msg string) BindFunc {
 var Requeue = Retry
 
 func Retry(msg string) BindFunc {
-	return NewStepBinder(NewStep("Retry",
+	return NewStepBinder(newControlStep("Retry",
 		func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
 			return flow.Retry(msg)
 		}),
@@ -41,7 +51,7 @@ func Retry(msg string) BindFunc {
 var RequeueAfter = RetryAfter
 
 func RetryAfter(d time.Duration, msg string) BindFunc {
-	return NewStepBinder(NewStep("RetryAfter"+d.String(),
+	return NewStepBinder(newControlStep("RetryAfter"+d.String(),
 		func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
 			return flow.RetryAfter(d, msg)
 		}),
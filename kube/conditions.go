@@ -0,0 +1,136 @@
+package kube
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	ConditionReasonSucceeded = "StepSucceeded"
+	ConditionReasonFailed    = "StepFailed"
+	ConditionReasonWaiting   = "StepWaiting"
+)
+
+// ObjectWithConditions is an object with []metav1.Condition in its status.
+type ObjectWithConditions interface {
+	client.Object
+	GetConditions() []metav1.Condition
+	SetConditions(conditions []metav1.Condition)
+}
+
+// conditionSet collects the conditions reported by steps in a run.
+type conditionSet struct {
+	mu         sync.Mutex
+	conditions []metav1.Condition
+}
+
+func (s *conditionSet) report(cond metav1.Condition) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The last reported wins.
+	meta.SetStatusCondition(&s.conditions, cond)
+}
+
+// apply sets the reported conditions to the object, and returns true if they are changed.
+func (s *conditionSet) apply(obj ObjectWithConditions) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := obj.GetConditions()
+	conditions := make([]metav1.Condition, len(current))
+	copy(conditions, current)
+	for _, c := range s.conditions {
+		c.ObservedGeneration = obj.GetGeneration()
+		meta.SetStatusCondition(&conditions, c)
+	}
+	if equality.Semantic.DeepEqual(current, conditions) {
+		return false
+	}
+	obj.SetConditions(conditions)
+	return true
+}
+
+type conditionStep struct {
+	Step
+	conditionType string
+}
+
+func (s *conditionStep) Execute(rc ReconcileContext, f Flow) (reconcile.Result, error) {
+	inner, ok := f.(*flow)
+	if !ok || inner.conditions == nil {
+		return s.Step.Execute(rc, f)
+	}
+
+	// Only count the breaks and errors happening in the step.
+	broken, prevErr := inner.BreakLoop(), inner.stepErr()
+	result, err := s.Step.Execute(rc, f)
+
+	stepErr := err
+	if stepErr == nil && inner.stepErr() != prevErr {
+		stepErr = inner.stepErr()
+	}
+	cond := metav1.Condition{
+		Type:    s.conditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  ConditionReasonSucceeded,
+		Message: "Step " + s.Step.Name() + " succeeded.",
+	}
+	switch {
+	case stepErr != nil:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = ConditionReasonFailed
+		cond.Message = stepErr.Error()
+	case !broken && inner.BreakLoop():
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = ConditionReasonWaiting
+		cond.Message = "Step " + s.Step.Name() + " is waiting."
+	}
+	inner.activeConditions().report(cond)
+
+	return result, err
+}
+
+// ReportsCondition marks the steps of the binders to report the condition type, which
+// is True when a step continues, False with the error message when it fails, and
+// Unknown when it breaks the flow otherwise. The conditions are written to the object
+// set by WithStatusConditions, and the last reported wins if more than one steps report
+// the same type.
+func ReportsCondition(conditionType string, binders ...BindFunc) BindFunc {
+	return func(t *Task, deferred ...bool) {
+		for _, step := range ExtractStepsFromBindFunc(binders...) {
+			NewStepBinder(&conditionStep{Step: step, conditionType: conditionType})(t, deferred...)
+		}
+	}
+}
+
+// patchConditions patches the status of the object with the reported conditions.
+func (e *executor) patchConditions(rc ReconcileContext) error {
+	obj := e.conditionObject
+	return rc.PatchStatus(obj, func() {
+		e.conditions.apply(obj)
+	})
+}
+
+// WithStatusConditions writes the conditions reported by the steps, see ReportsCondition,
+// to the object. The status subresource is patched once at the end of the run by
+// rc.PatchStatus, with the observedGeneration of the conditions set to the generation
+// of the object.
+func WithStatusConditions(obj ObjectWithConditions) ExecutorOption {
+	return func(e *executor) {
+		e.conditionObject = obj
+		e.conditions = &conditionSet{}
+		if f, ok := e.flow.(*flow); ok {
+			f.conditions = e.conditions
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type testObjectWithConditions struct {
+	unstructured.Unstructured
+}
+
+func (o *testObjectWithConditions) GetConditions() []metav1.Condition {
+	conditions := make([]metav1.Condition, 0)
+	items, _, _ := unstructured.NestedSlice(o.Object, "status", "conditions")
+	for _, item := range items {
+		c := metav1.Condition{}
+		_ = runtime.DefaultUnstructuredConverter.FromUnstructured(item.(map[string]interface{}), &c)
+		conditions = append(conditions, c)
+	}
+	return conditions
+}
+
+func (o *testObjectWithConditions) SetConditions(conditions []metav1.Condition) {
+	items := make([]interface{}, 0, len(conditions))
+	for i := range conditions {
+		item, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(&conditions[i])
+		items = append(items, item)
+	}
+	_ = unstructured.SetNestedSlice(o.Object, items, "status", "conditions")
+}
+
+func (o *testObjectWithConditions) DeepCopyObject() runtime.Object {
+	return &testObjectWithConditions{Unstructured: *o.Unstructured.DeepCopy()}
+}
+
+func TestWithStatusConditions(t *testing.T) {
+	obj := &testObjectWithConditions{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("Database")
+	obj.SetNamespace("default")
+	obj.SetName("db")
+	obj.SetGeneration(3)
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(&obj.Unstructured).Build()
+	rc := NewBaseReconcileContext(NewDefaultReconcileHelper(c, nil, nil, scheme.Scheme), context.Background(),
+		reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "db"}}, "test", nil)
+
+	task := NewTask()
+	ReportsCondition("Configured", NewStepBinder(NewStep("configure", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		return flow.Pass()
+	})))(task)
+	Parallel(
+		ReportsCondition("Replicated", NewStepBinder(NewStep("replicate", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			return flow.RetryErr(errors.New("replica not ready"), "Not ready.")
+		}))),
+		ReportsCondition("Backed", Wait("backup")),
+	)(task)
+
+	_, err := NewExecutor(logr.Discard(), WithStatusConditions(obj)).Execute(rc, task)
+	assert.NoError(t, err)
+
+	actual := &unstructured.Unstructured{}
+	actual.SetAPIVersion("example.com/v1")
+	actual.SetKind("Database")
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(obj), actual))
+	conditions := (&testObjectWithConditions{Unstructured: *actual}).GetConditions()
+	assert.Len(t, conditions, 3)
+	for _, cond := range conditions {
+		assert.EqualValues(t, 3, cond.ObservedGeneration)
+		assert.False(t, cond.LastTransitionTime.IsZero())
+		switch cond.Type {
+		case "Configured":
+			assert.Equal(t, metav1.ConditionTrue, cond.Status)
+		case "Replicated":
+			assert.Equal(t, metav1.ConditionFalse, cond.Status)
+			assert.Equal(t, "replica not ready", cond.Message)
+		case "Backed":
+			assert.Equal(t, metav1.ConditionUnknown, cond.Status)
+		}
+	}
+}
@@ -7,10 +7,7 @@ import (
 	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/pkg/errors"
 	"github.com/sqc157400661/util"
-	appsv1 "k8s.io/api/apps/v1"
-	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -20,6 +17,7 @@ import (
 	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
 )
 
 // ReconcileContext declares the context for reconciliation.
@@ -43,8 +41,12 @@ type ReconcileContext interface {
 	Get(object client.Object) error
 	List(list client.ObjectList, selector labels.Selector) error
 	Patch(object client.Object, patch client.Patch, options ...client.PatchOption) error
-	Apply(object client.Object) error                       // Server-Side Apply
-	CSAApply(new client.Object, old ...client.Object) error // Client-Side Apply
+	Apply(object client.Object) error                          // Server-Side Apply
+	CSAApply(new client.Object, old ...client.Object) error    // Client-Side Apply
+	PatchStatus(object client.Object, mutate func()) error     // Merge patch of the status subresource
+	ApplyStatus(object client.Object) error                    // Server-Side Apply of the status subresource
+	AcquireLease(name string, ttl time.Duration) (bool, error) // Acquire or renew a Lease
+	ReleaseLease(name string) error                            // Release a held Lease
 	Close() error
 }
 
@@ -86,6 +88,15 @@ func (rc *BaseReconcileContext) shallowCopy() *BaseReconcileContext {
 	return &shallowCopy
 }
 
+// WithContext returns a shallow copy of the reconcile context bound to ctx. It's used
+// by the executor to apply step timeouts. Types embedding BaseReconcileContext should
+// override it if the steps expect their own type.
+func (rc *BaseReconcileContext) WithContext(ctx context.Context) ReconcileContext {
+	c := rc.shallowCopy()
+	c.context = ctx
+	return c
+}
+
 func (rc *BaseReconcileContext) Get(object client.Object) error {
 	return rc.Client().Get(rc.context, client.ObjectKeyFromObject(object), object)
 }
@@ -108,86 +119,16 @@ func (rc *BaseReconcileContext) Patch(object client.Object,
 	return rc.Client().Patch(rc.context, object, patch, options...)
 }
 
-// when not support server-side apply, use it
+// CSAApply applies the object when server-side apply is not supported, by
+// ClientSideApply with a three-way merge for any kinds, including the unstructured
+// objects and custom resources. The old object is the live one fetched if not passed,
+// and a nil one means the object doesn't exist.
 func (rc *BaseReconcileContext) CSAApply(object client.Object, oldObject ...client.Object) error {
-	var old client.Object
 	var err error
 	if len(oldObject) > 0 {
-		old = oldObject[0]
-		if old == nil {
-			return client.IgnoreAlreadyExists(rc.Client().Create(rc.context, object))
-		}
+		_, err = clientSideApply(rc, object, oldObject[0])
 	} else {
-		old = reflect.New(reflect.TypeOf(object).Elem()).Interface().(client.Object)
-		err := rc.Client().Get(rc.context, client.ObjectKeyFromObject(object), old)
-		if err != nil {
-			if client.IgnoreNotFound(err) != nil {
-				return err
-			}
-			return client.IgnoreAlreadyExists(rc.Client().Create(rc.context, object))
-		}
-	}
-	patch := util.NewMergePatch()
-	patch.PatchLabels(object.GetLabels(), old.GetLabels())
-	patch.PatchAnnos(object.GetAnnotations(), old.GetAnnotations())
-	switch actual := object.(type) {
-	case *corev1.ConfigMap:
-		oldObj := old.(*corev1.ConfigMap)
-		patch.PatchStringMap([]string{"data"}, actual.Data, oldObj.Data)
-	case *corev1.Endpoints:
-		oldObj := old.(*corev1.Endpoints)
-		if !equality.Semantic.DeepEqual(actual.Subsets, oldObj.Subsets) {
-			patch.Add("subsets")(actual.Subsets)
-		}
-	case *corev1.PersistentVolumeClaim:
-		oldObj := old.(*corev1.PersistentVolumeClaim)
-		if !equality.Semantic.DeepEqual(actual.Spec, oldObj.Spec) {
-			patch.Add("spec")(actual.Spec)
-		}
-	case *corev1.Secret:
-		oldObj := old.(*corev1.Secret)
-		patch.PatchByteMap([]string{"data"}, actual.Data, oldObj.Data)
-	case *corev1.Service:
-		oldObj := old.(*corev1.Service)
-		if !equality.Semantic.DeepEqual(actual.Spec, oldObj.Spec) {
-			patch.Add("spec")(actual.Spec)
-		}
-	case *corev1.ServiceAccount:
-	case *appsv1.Deployment:
-		oldObj := old.(*appsv1.Deployment)
-		if !equality.Semantic.DeepEqual(actual.Spec, oldObj.Spec) {
-			patch.Add("spec")(actual.Spec)
-		}
-	case *appsv1.StatefulSet:
-		oldObj := old.(*appsv1.StatefulSet)
-		if !equality.Semantic.DeepEqual(actual.Spec, oldObj.Spec) {
-			patch.Add("spec")(actual.Spec)
-		}
-	case *batchv1.Job:
-		oldObj := old.(*batchv1.Job)
-		if !equality.Semantic.DeepEqual(actual.Spec, oldObj.Spec) {
-			patch.Add("spec")(actual.Spec)
-		}
-	case *batchv1.CronJob:
-		oldObj := old.(*batchv1.CronJob)
-		if !equality.Semantic.DeepEqual(actual.Spec, oldObj.Spec) {
-			patch.Add("spec")(actual.Spec)
-		}
-	case *rbacv1.RoleBinding:
-		oldObj := old.(*rbacv1.RoleBinding)
-		if !equality.Semantic.DeepEqual(actual.Subjects, oldObj.Subjects) {
-			patch.Add("subjects")(actual.Subjects)
-		}
-	case *corev1.Pod:
-		oldObj := old.(*corev1.Pod)
-		if !equality.Semantic.DeepEqual(actual.Spec.Containers, oldObj.Spec.Containers) {
-			patch.Add("spec")(actual.Spec)
-		}
-	default:
-	}
-	if !patch.IsEmpty() {
-		fmt.Printf("type :%T do Patch\n", object)
-		err = rc.Client().Patch(rc.context, object, patch)
+		_, err = ClientSideApply(rc, object)
 	}
 	return err
 }
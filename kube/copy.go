@@ -0,0 +1,281 @@
+package kube
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultCopyMaxBytes is the default limit of the total size of the files copied.
+	DefaultCopyMaxBytes = 64 << 20
+	// DefaultCopyTimeout is the default timeout of the exec streaming the files.
+	DefaultCopyTimeout = 1 * time.Minute
+)
+
+// ErrCopyTooLarge is returned when the files copied exceed the size limit.
+var ErrCopyTooLarge = errors.New("files to copy exceed the size limit")
+
+// CopyOptions are the options of CopyToPod and CopyFromPod.
+type CopyOptions struct {
+	// MaxBytes limits the total size of the files, defaults to DefaultCopyMaxBytes.
+	MaxBytes int64
+	// Timeout is the timeout of the exec, defaults to DefaultCopyTimeout.
+	Timeout time.Duration
+}
+
+func (opts *CopyOptions) setDefaults() {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultCopyMaxBytes
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultCopyTimeout
+	}
+}
+
+// PodExecFunc executes the command in a container, e.g. a PodExec bound to the pod
+// and the container.
+type PodExecFunc func(command []string, opts ExecOptions) error
+
+// writeTar writes the local file or directory into the tar stream, with the names
+// relative to its parent. Links and other special files are skipped.
+func writeTar(w io.Writer, src string, maxBytes int64) error {
+	src = filepath.Clean(src)
+	base := filepath.Dir(src)
+
+	// Check the size before streaming anything.
+	var total int64
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if total > maxBytes {
+		return fmt.Errorf("%w: %d > %d bytes", ErrCopyTooLarge, total, maxBytes)
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.CopyN(tw, f, info.Size())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar extracts the tar stream into the local directory. Entries escaping the
+// directory are rejected, links and other special files are skipped.
+func extractTar(r io.Reader, dst string, maxBytes int64) error {
+	dst, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(hdr.Name))
+		if rel, err := filepath.Rel(dst, target); err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) || path.IsAbs(hdr.Name) {
+			return fmt.Errorf("illegal file path in archive: %s", hdr.Name)
+		}
+
+		mode := hdr.FileInfo().Mode().Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > maxBytes {
+				return fmt.Errorf("%w: more than %d bytes", ErrCopyTooLarge, maxBytes)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := extractFile(tr, target, mode); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Modes are masked by umask on creation.
+	return os.Chmod(target, mode)
+}
+
+// streamExec executes the command with podExec while stream produces or consumes the
+// other end of the pipe, and returns when both are finished or ctx is done.
+func streamExec(ctx context.Context, podExec PodExecFunc, command []string, opts ExecOptions,
+	pr *io.PipeReader, pw *io.PipeWriter, stream func() error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	stderr := &bytes.Buffer{}
+	opts.Stderr = stderr
+
+	execDone, streamDone := make(chan error, 1), make(chan error, 1)
+	go func() {
+		err := podExec(command, opts)
+		// Unblock the stream.
+		if err != nil {
+			_ = pr.CloseWithError(err)
+		}
+		_ = pw.Close()
+		execDone <- err
+	}()
+	go func() {
+		err := stream()
+		// Unblock the exec.
+		if err != nil {
+			_ = pr.CloseWithError(err)
+		}
+		_ = pw.CloseWithError(err)
+		streamDone <- err
+	}()
+
+	var execErr, streamErr error
+	for i := 0; i < 2; i++ {
+		select {
+		case execErr = <-execDone:
+		case streamErr = <-streamDone:
+		case <-ctx.Done():
+			_ = pr.CloseWithError(ctx.Err())
+			_ = pw.CloseWithError(ctx.Err())
+			return ctx.Err()
+		}
+	}
+
+	// The stream error is the cause if both fail, unless it's propagated from the exec.
+	if streamErr != nil && (execErr == nil || !errors.Is(streamErr, execErr)) {
+		return streamErr
+	}
+	if execErr != nil && stderr.Len() > 0 {
+		return fmt.Errorf("%w: %s", execErr, strings.TrimSpace(stderr.String()))
+	}
+	return execErr
+}
+
+// CopyToPodWith copies the local file or directory src into the directory dst in the
+// container with podExec, see CopyToPod.
+func CopyToPodWith(ctx context.Context, podExec PodExecFunc, src, dst string, opts CopyOptions) error {
+	opts.setDefaults()
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	return streamExec(ctx, podExec, []string{"tar", "-xmf", "-", "-C", dst},
+		ExecOptions{Stdin: pr, Timeout: opts.Timeout}, pr, pw,
+		func() error {
+			return writeTar(pw, src, opts.MaxBytes)
+		})
+}
+
+// CopyFromPodWith copies the file or directory src in the container into the local
+// directory dst with podExec, see CopyFromPod.
+func CopyFromPodWith(ctx context.Context, podExec PodExecFunc, src, dst string, opts CopyOptions) error {
+	opts.setDefaults()
+	src = path.Clean(src)
+
+	pr, pw := io.Pipe()
+	return streamExec(ctx, podExec, []string{"tar", "cf", "-", "-C", path.Dir(src), path.Base(src)},
+		ExecOptions{Stdout: pw, Timeout: opts.Timeout}, pr, pw,
+		func() error {
+			if err := extractTar(pr, dst, opts.MaxBytes); err != nil {
+				return err
+			}
+			// Drain the padding after the end of the archive.
+			_, err := io.Copy(io.Discard, pr)
+			return err
+		})
+}
+
+// CopyToPod copies the local file or directory src into the existing directory dst in
+// the container, like kubectl cp, by streaming a tar archive to tar in the container,
+// which must be installed. File modes are kept, and links are skipped.
+func (rc *DefaultReconcileHelper) CopyToPod(ctx context.Context, pod *corev1.Pod, container string, src, dst string, opts CopyOptions) error {
+	return CopyToPodWith(ctx, func(command []string, opts ExecOptions) error {
+		return rc.podExec(ctx, pod, container, command, opts)
+	}, src, dst, opts)
+}
+
+// CopyFromPod copies the file or directory src in the container into the local directory
+// dst, like kubectl cp, by streaming a tar archive from tar in the container, which must
+// be installed. File modes are kept, links are skipped, and the entries escaping dst are
+// rejected.
+func (rc *DefaultReconcileHelper) CopyFromPod(ctx context.Context, pod *corev1.Pod, container string, src, dst string, opts CopyOptions) error {
+	return CopyFromPodWith(ctx, func(command []string, opts ExecOptions) error {
+		return rc.podExec(ctx, pod, container, command, opts)
+	}, src, dst, opts)
+}
@@ -0,0 +1,70 @@
+package kube
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePodFS is a pod executing tar commands in a local directory.
+func fakePodFS(t *testing.T, root string) PodExecFunc {
+	return func(command []string, opts ExecOptions) error {
+		switch {
+		case command[0] == "tar" && command[1] == "-xmf":
+			return extractTar(opts.Stdin, filepath.Join(root, command[4]), DefaultCopyMaxBytes)
+		case command[0] == "tar" && command[1] == "cf":
+			return writeTar(opts.Stdout, filepath.Join(root, command[4], command[5]), DefaultCopyMaxBytes)
+		}
+		t.Fatalf("unexpected command %v", command)
+		return nil
+	}
+}
+
+func TestCopyToAndFromPod(t *testing.T) {
+	local, pod := t.TempDir(), t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(local, "conf", "sub"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(local, "conf", "my.cnf"), []byte("[mysqld]"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(local, "conf", "sub", "run.sh"), []byte("#!/bin/sh"), 0o755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(pod, "etc"), 0o755))
+
+	exec := fakePodFS(t, pod)
+	assert.NoError(t, CopyToPodWith(context.Background(), exec, filepath.Join(local, "conf"), "/etc", CopyOptions{}))
+	data, err := os.ReadFile(filepath.Join(pod, "etc", "conf", "my.cnf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[mysqld]", string(data))
+
+	back := t.TempDir()
+	assert.NoError(t, CopyFromPodWith(context.Background(), exec, "/etc/conf", back, CopyOptions{}))
+	info, err := os.Stat(filepath.Join(back, "conf", "sub", "run.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(back, "conf", "my.cnf"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// Size limit.
+	err = CopyToPodWith(context.Background(), exec, filepath.Join(local, "conf"), "/etc", CopyOptions{MaxBytes: 4})
+	assert.ErrorIs(t, err, ErrCopyTooLarge)
+}
+
+func TestCopyFromPodRejectsPathTraversal(t *testing.T) {
+	dst := t.TempDir()
+	err := CopyFromPodWith(context.Background(), func(command []string, opts ExecOptions) error {
+		tw := tar.NewWriter(opts.Stdout)
+		content := []byte("evil")
+		if err := tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+		return tw.Close()
+	}, "/etc/conf", dst, CopyOptions{})
+	assert.ErrorContains(t, err, "illegal file path")
+	_, err = os.Stat(filepath.Join(filepath.Dir(dst), "evil"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,414 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+)
+
+type diagramShape int
+
+const (
+	shapeStep diagramShape = iota
+	shapeDecision
+	shapeControl
+	shapeTerminal
+	shapeJunction
+)
+
+type diagramNode struct {
+	id    string
+	label string
+	shape diagramShape
+}
+
+// diagramGroup is a subgraph, its items are either nodes or nested groups.
+type diagramGroup struct {
+	id    string
+	label string
+	items []interface{}
+}
+
+type diagramEdge struct {
+	from, to string
+	label    string
+	dashed   bool
+}
+
+// diagramExit is a pending edge leaving a fragment of the diagram.
+type diagramExit struct {
+	from  string
+	label string
+}
+
+// diagram is the structure of a task, which is rendered as Mermaid or DOT.
+type diagram struct {
+	root   *diagramGroup
+	edges  []diagramEdge
+	breaks []string
+	nodes  int
+	groups int
+}
+
+func (d *diagram) node(g *diagramGroup, label string, shape diagramShape) string {
+	d.nodes++
+	n := &diagramNode{id: fmt.Sprintf("n%d", d.nodes), label: label, shape: shape}
+	g.items = append(g.items, n)
+	return n.id
+}
+
+func (d *diagram) group(parent *diagramGroup, label string) *diagramGroup {
+	d.groups++
+	g := &diagramGroup{id: fmt.Sprintf("c%d", d.groups), label: label}
+	parent.items = append(parent.items, g)
+	return g
+}
+
+func (d *diagram) edge(from, to, label string) {
+	d.edges = append(d.edges, diagramEdge{from: from, to: to, label: label})
+}
+
+func (d *diagram) connect(exits []diagramExit, to string) {
+	for _, exit := range exits {
+		d.edge(exit.from, to, exit.label)
+	}
+}
+
+// sequence draws the steps in order, and returns the entry and the exits of them. The
+// entry is empty if there are no steps.
+func (d *diagram) sequence(g *diagramGroup, steps []Step) (entry string, exits []diagramExit) {
+	for _, s := range steps {
+		e, x := d.step(g, s)
+		if entry == "" {
+			entry = e
+		} else {
+			d.connect(exits, e)
+		}
+		exits = x
+	}
+	return entry, exits
+}
+
+// wrap draws the steps in a group, or a single node if there are no steps.
+func (d *diagram) wrap(g *diagramGroup, label string, steps []Step) (string, []diagramExit) {
+	if len(steps) == 0 {
+		id := d.node(g, label, shapeStep)
+		return id, []diagramExit{{from: id}}
+	}
+	return d.sequence(d.group(g, label), steps)
+}
+
+// branch draws the steps after the decision, and returns the exits of them, or the
+// decision itself if there are no steps.
+func (d *diagram) branch(g *diagramGroup, decision, label string, steps []Step) []diagramExit {
+	entry, exits := d.sequence(g, steps)
+	if entry == "" {
+		return []diagramExit{{from: decision, label: label}}
+	}
+	d.edge(decision, entry, label)
+	return exits
+}
+
+// fork draws the steps from a fork node to a join node, with the edges between them.
+func (d *diagram) fork(g *diagramGroup, label string, steps []Step) (string, []diagramExit) {
+	fork := d.node(g, label, shapeJunction)
+	parent := d.group(g, label)
+	var exits []diagramExit
+	for _, s := range steps {
+		e, x := d.step(parent, s)
+		d.edge(fork, e, "")
+		exits = append(exits, x...)
+	}
+	join := d.node(g, "Join", shapeJunction)
+	if len(steps) == 0 {
+		exits = []diagramExit{{from: fork}}
+	}
+	d.connect(exits, join)
+	return fork, []diagramExit{{from: join}}
+}
+
+func (d *diagram) graph(g *diagramGroup, s *graph) (string, []diagramExit) {
+	fork := d.node(g, "Graph", shapeJunction)
+	parent := d.group(g, s.Name())
+
+	entries := make(map[string]string, len(s.nodes))
+	exits := make(map[string][]diagramExit, len(s.nodes))
+	dependents := make(map[string]bool, len(s.nodes))
+	for _, level := range s.levels {
+		for _, n := range level {
+			entries[n.name], exits[n.name] = d.wrap(parent, n.name, ExtractStepsFromBindFunc(n.binders...))
+			if len(n.dependsOn) == 0 {
+				d.edge(fork, entries[n.name], "")
+			}
+			for _, dep := range n.dependsOn {
+				d.connect(exits[dep], entries[n.name])
+				dependents[dep] = true
+			}
+		}
+	}
+
+	join := d.node(g, "Join", shapeJunction)
+	for _, level := range s.levels {
+		for _, n := range level {
+			if !dependents[n.name] {
+				d.connect(exits[n.name], join)
+			}
+		}
+	}
+	return fork, []diagramExit{{from: join}}
+}
+
+func (d *diagram) phaseMachine(g *diagramGroup, s *phaseMachine) (string, []diagramExit) {
+	parent := d.group(g, s.Name())
+
+	draw := func(label string, phase *Phase) (string, []diagramExit) {
+		phaseGroup := d.group(parent, label)
+		entry, exits := d.sequence(phaseGroup, ExtractStepsFromBindFunc(phase.binders...))
+		if entry == "" {
+			entry = d.node(phaseGroup, phase.name, shapeStep)
+			exits = []diagramExit{{from: entry}}
+		}
+		if phase.exit != nil {
+			decision := d.node(phaseGroup, phase.exit.Name(), shapeDecision)
+			d.connect(exits, decision)
+			retry := d.node(phaseGroup, "RetryAfter"+phase.interval.String(), shapeControl)
+			d.breaks = append(d.breaks, retry)
+			d.edge(decision, retry, "false")
+			exits = []diagramExit{{from: decision, label: "true"}}
+		}
+		return entry, exits
+	}
+
+	var entry string
+	var exits, failures []diagramExit
+	for _, phase := range s.phases {
+		e, x := draw("Phase "+phase.name, phase)
+		if entry == "" {
+			entry = e
+		} else {
+			d.connect(exits, e)
+		}
+		exits = x
+		if phase.timeout > 0 {
+			failures = append(failures, diagramExit{from: e, label: "timeout " + phase.timeout.String()})
+		}
+		if phase.failOnError {
+			failures = append(failures, diagramExit{from: e, label: "error"})
+		}
+	}
+
+	if s.failure != nil && len(failures) > 0 {
+		e, x := draw("Failure phase "+s.failure.name, s.failure)
+		for _, exit := range failures {
+			d.edges = append(d.edges, diagramEdge{from: exit.from, to: e, label: exit.label, dashed: true})
+		}
+		exits = append(exits, x...)
+	}
+	return entry, exits
+}
+
+// step draws the step, and returns its entry and exits.
+func (d *diagram) step(g *diagramGroup, s Step) (string, []diagramExit) {
+	switch s := s.(type) {
+	case *controlStep:
+		id := d.node(g, s.Name(), shapeControl)
+		d.breaks = append(d.breaks, id)
+		return id, nil
+	case *conditionStep:
+		return d.step(g, s.Step)
+	case *milestoneStep:
+		return d.step(g, s.Step)
+	case *timeoutStep:
+		return d.wrap(g, "Timeout("+s.timeout.String()+")", []Step{s.Step})
+	case *retryStep:
+		return d.wrap(g, "WithRetryPolicy", []Step{s.Step})
+	case *block:
+		return d.wrap(g, s.name, ExtractStepsFromBindFunc(s.binders...))
+	case *exclusive:
+		return d.wrap(g, s.Name(), ExtractStepsFromBindFunc(s.binders...))
+	case *onDeletion:
+		return d.wrap(g, s.Name(), ExtractStepsFromBindFunc(s.binders...))
+	case *stepIf:
+		decision := d.node(g, s.cond.Name(), shapeDecision)
+		exits := d.branch(g, decision, "true", []Step{s.step})
+		return decision, append(exits, diagramExit{from: decision, label: "false"})
+	case *stepIfElse:
+		decision := d.node(g, s.cond.Name(), shapeDecision)
+		exits := d.branch(g, decision, "true", ExtractStepsFromBindFunc(s.thenBinders...))
+		return decision, append(exits, d.branch(g, decision, "false", ExtractStepsFromBindFunc(s.elseBinders...))...)
+	case *switchStep:
+		decision := d.node(g, "Switch", shapeDecision)
+		var exits []diagramExit
+		hasDefault := false
+		for _, c := range s.cases {
+			label := "Default"
+			if c.cond != nil {
+				label = c.cond.Name()
+			} else {
+				hasDefault = true
+			}
+			exits = append(exits, d.branch(g, decision, label, ExtractStepsFromBindFunc(c.binders...))...)
+		}
+		if !hasDefault {
+			exits = append(exits, diagramExit{from: decision, label: "none"})
+		}
+		return decision, exits
+	case *parallel:
+		return d.fork(g, "Parallel", s.steps)
+	case *graph:
+		return d.graph(g, s)
+	case *phaseMachine:
+		return d.phaseMachine(g, s)
+	default:
+		id := d.node(g, s.Name(), shapeStep)
+		return id, []diagramExit{{from: id}}
+	}
+}
+
+// newDiagram binds the binders and draws the steps, the binders bound lazily included.
+func newDiagram(binders ...BindFunc) *diagram {
+	task := NewTask()
+	for _, b := range binders {
+		b(task)
+	}
+
+	d := &diagram{root: &diagramGroup{}}
+	start := d.node(d.root, "Start", shapeTerminal)
+	entry, exits := d.sequence(d.root, task.steps)
+	if entry == "" {
+		exits = []diagramExit{{from: start}}
+	} else {
+		d.edge(start, entry, "")
+	}
+	done := d.node(d.root, "Done", shapeTerminal)
+	d.connect(exits, done)
+	for _, b := range d.breaks {
+		d.edges = append(d.edges, diagramEdge{from: b, to: done, dashed: true})
+	}
+
+	// Deferred steps never break the flow, they are always executed in order.
+	if len(task.deferredSteps) > 0 {
+		entry, exits := d.sequence(d.group(d.root, "Deferred"), task.deferredSteps)
+		d.edge(done, entry, "defer")
+		end := d.node(d.root, "End", shapeTerminal)
+		d.connect(exits, end)
+	}
+	return d
+}
+
+func mermaidLabel(label string) string {
+	return `"` + strings.ReplaceAll(label, `"`, "#quot;") + `"`
+}
+
+func (d *diagram) writeMermaid(b *strings.Builder, g *diagramGroup, indent string) {
+	for _, item := range g.items {
+		switch item := item.(type) {
+		case *diagramNode:
+			label := mermaidLabel(item.label)
+			switch item.shape {
+			case shapeDecision:
+				label = "{" + label + "}"
+			case shapeControl:
+				label = "{{" + label + "}}"
+			case shapeTerminal:
+				label = "((" + label + "))"
+			case shapeJunction:
+				label = "([" + label + "])"
+			default:
+				label = "[" + label + "]"
+			}
+			fmt.Fprintf(b, "%s%s%s\n", indent, item.id, label)
+		case *diagramGroup:
+			fmt.Fprintf(b, "%ssubgraph %s [%s]\n", indent, item.id, mermaidLabel(item.label))
+			d.writeMermaid(b, item, indent+"    ")
+			fmt.Fprintf(b, "%send\n", indent)
+		}
+	}
+}
+
+// RenderMermaid renders the structure of the task bound by the binders as a Mermaid
+// flowchart, e.g. to be embedded in design docs. See RenderDOT for what's drawn.
+//
+// Like RenderDOT, it binds every binder including the lazily bound ones, so the binders
+// must be side-effect free to be rendered.
+func RenderMermaid(binders ...BindFunc) string {
+	d := newDiagram(binders...)
+
+	b := &strings.Builder{}
+	b.WriteString("flowchart TD\n")
+	d.writeMermaid(b, d.root, "    ")
+	for _, e := range d.edges {
+		arrow := "-->"
+		if e.dashed {
+			arrow = "-.->"
+		}
+		if e.label != "" {
+			arrow += "|" + mermaidLabel(e.label) + "|"
+		}
+		fmt.Fprintf(b, "    %s %s %s\n", e.from, arrow, e.to)
+	}
+	return b.String()
+}
+
+func dotLabel(label string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(label) + `"`
+}
+
+func (d *diagram) writeDOT(b *strings.Builder, g *diagramGroup, indent string) {
+	for _, item := range g.items {
+		switch item := item.(type) {
+		case *diagramNode:
+			shape := "box"
+			switch item.shape {
+			case shapeDecision:
+				shape = "diamond"
+			case shapeControl:
+				shape = "hexagon"
+			case shapeTerminal:
+				shape = "circle"
+			case shapeJunction:
+				shape = "oval"
+			}
+			fmt.Fprintf(b, "%s%s [label=%s, shape=%s];\n", indent, item.id, dotLabel(item.label), shape)
+		case *diagramGroup:
+			fmt.Fprintf(b, "%ssubgraph cluster_%s {\n", indent, item.id)
+			fmt.Fprintf(b, "%s    label=%s;\n", indent, dotLabel(item.label))
+			d.writeDOT(b, item, indent+"    ")
+			fmt.Fprintf(b, "%s}\n", indent)
+		}
+	}
+}
+
+// RenderDOT renders the structure of the task bound by the binders as a Graphviz DOT
+// graph. The steps are drawn in order from Start to Done, followed by the deferred steps.
+// The conditions of StepIf, StepIfElse and Switch are drawn as decisions with their names,
+// and Wait, Abort, Retry and RetryAfter are drawn as the ends of their paths. The steps
+// containing others, e.g. Parallel, Graph, Timeout and PhaseMachine, are drawn as
+// subgraphs. Note When, Branch and Block take plain bools and are resolved when bound, so
+// only the bound branches are drawn.
+//
+// Rendering binds every binder, including the ones bound lazily when executed, e.g. by
+// Graph, Exclusive and PhaseMachine, but never executes any steps. So the binders must be
+// side-effect free to be rendered: they only bind steps, and never read or write objects.
+func RenderDOT(binders ...BindFunc) string {
+	d := newDiagram(binders...)
+
+	b := &strings.Builder{}
+	b.WriteString("digraph task {\n")
+	d.writeDOT(b, d.root, "    ")
+	for _, e := range d.edges {
+		var attrs []string
+		if e.label != "" {
+			attrs = append(attrs, "label="+dotLabel(e.label))
+		}
+		if e.dashed {
+			attrs = append(attrs, "style=dashed")
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(b, "    %s -> %s [%s];\n", e.from, e.to, strings.Join(attrs, ", "))
+		} else {
+			fmt.Fprintf(b, "    %s -> %s;\n", e.from, e.to)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
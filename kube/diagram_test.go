@@ -0,0 +1,138 @@
+package kube
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func noopStep(name string) BindFunc {
+	return NewStepBinder(NewStep(name, func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		return flow.Pass()
+	}))
+}
+
+func TestRenderMermaid(t *testing.T) {
+	ready := NewCondition("Ready", func(rc ReconcileContext, log logr.Logger) (bool, error) {
+		return true, nil
+	})
+
+	mermaid := RenderMermaid(
+		noopStep("load"),
+		StepIfElse(ready, []BindFunc{noopStep("sync")}, []BindFunc{RetryAfter(time.Second, "Not ready.")}),
+		Parallel(noopStep("a"), noopStep(`say "b"`)),
+		func(task *Task, deferred ...bool) {
+			noopStep("cleanup")(task, true)
+		},
+	)
+	assert.Equal(t, `flowchart TD
+    n1(("Start"))
+    n2["load"]
+    n3{"Ready"}
+    n4["sync"]
+    n5{{"RetryAfter1s"}}
+    n6(["Parallel"])
+    subgraph c1 ["Parallel"]
+        n7["a"]
+        n8["say #quot;b#quot;"]
+    end
+    n9(["Join"])
+    n10(("Done"))
+    subgraph c2 ["Deferred"]
+        n11["cleanup"]
+    end
+    n12(("End"))
+    n3 -->|"true"| n4
+    n3 -->|"false"| n5
+    n2 --> n3
+    n6 --> n7
+    n6 --> n8
+    n7 --> n9
+    n8 --> n9
+    n4 --> n6
+    n1 --> n2
+    n9 --> n10
+    n5 -.-> n10
+    n10 -->|"defer"| n11
+    n11 --> n12
+`, mermaid)
+}
+
+func TestRenderDOT(t *testing.T) {
+	synced := NewCondition("Synced", func(rc ReconcileContext, log logr.Logger) (bool, error) {
+		return true, nil
+	})
+
+	dot := RenderDOT(
+		Switch(Case(synced, Wait("Synced.")), Case(Not(synced))),
+		Timeout(time.Minute, noopStep("slow")),
+		MustGraph(Node("a", noopStep("a1")), Node("b").DependsOn("a")),
+		MustPhaseMachine(&corev1.ConfigMap{}, "upgrade", []*Phase{
+			NewPhase("roll", noopStep("roll")).ExitWhen(synced).Timeout(time.Hour),
+		}, NewPhase("rollback")),
+	)
+	assert.True(t, strings.HasPrefix(dot, "digraph task {\n"))
+	for _, line := range []string{
+		`n2 [label="Switch", shape=diamond];`,
+		`n3 [label="Wait", shape=hexagon];`,
+		`n2 -> n3 [label="Synced"];`,
+		`n2 -> n4 [label="Not(Synced)"];`,
+		`n2 -> n4 [label="none"];`,
+		`label="Timeout(1m0s)";`,
+		`label="Graph(a;b)";`,
+		`n7 [label="b", shape=box];`,
+		`label="Phase roll";`,
+		`label="Failure phase rollback";`,
+		`label="timeout 1h0m0s", style=dashed];`,
+		`n3 -> n13 [style=dashed];`,
+		`n11 -> n13 [style=dashed];`,
+	} {
+		assert.Contains(t, dot, line)
+	}
+}
+
+func TestRenderEmptyBranches(t *testing.T) {
+	ready := NewCondition("Ready", func(rc ReconcileContext, log logr.Logger) (bool, error) {
+		return true, nil
+	})
+	binders := []BindFunc{
+		StepIfElse(ready, nil, nil),
+		Switch(Case(ready, noopStep("a")), Case(Not(ready))),
+	}
+
+	// The empty branches go to the next step directly.
+	assert.Equal(t, `flowchart TD
+    n1(("Start"))
+    n2{"Ready"}
+    n3{"Switch"}
+    n4["a"]
+    n5(("Done"))
+    n3 -->|"Ready"| n4
+    n2 -->|"true"| n3
+    n2 -->|"false"| n3
+    n1 --> n2
+    n4 --> n5
+    n3 -->|"Not(Ready)"| n5
+    n3 -->|"none"| n5
+`, RenderMermaid(binders...))
+	assert.Equal(t, `digraph task {
+    n1 [label="Start", shape=circle];
+    n2 [label="Ready", shape=diamond];
+    n3 [label="Switch", shape=diamond];
+    n4 [label="a", shape=box];
+    n5 [label="Done", shape=circle];
+    n3 -> n4 [label="Ready"];
+    n2 -> n3 [label="true"];
+    n2 -> n3 [label="false"];
+    n1 -> n2;
+    n4 -> n5;
+    n3 -> n5 [label="Not(Ready)"];
+    n3 -> n5 [label="none"];
+}
+`, RenderDOT(binders...))
+}
@@ -0,0 +1,398 @@
+package kube
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+const EventReasonDriftDetected = "DriftDetected"
+
+// FieldDrift is a field whose live value differs from the desired one.
+type FieldDrift struct {
+	// Path is the path of the field, e.g. spec.template.spec.containers[0].image.
+	Path    string
+	Desired interface{}
+	Actual  interface{}
+}
+
+// ObjectDrift is the drift of an object.
+type ObjectDrift struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Missing is true if the object doesn't exist.
+	Missing bool
+	Fields  []FieldDrift
+}
+
+// DriftReport is the report of DetectDrift, listing the drifted objects.
+type DriftReport struct {
+	mu      sync.Mutex
+	objects []ObjectDrift
+}
+
+// Objects returns a copy of the drifted objects.
+func (r *DriftReport) Objects() []ObjectDrift {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	objects := make([]ObjectDrift, len(r.objects))
+	for i, o := range r.objects {
+		o.Fields = append([]FieldDrift(nil), o.Fields...)
+		objects[i] = o
+	}
+	return objects
+}
+
+// HasDrift returns true if any object drifts.
+func (r *DriftReport) HasDrift() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.objects) > 0
+}
+
+// String returns a human-readable summary of the report.
+func (r *DriftReport) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.objects) == 0 {
+		return "No drift detected."
+	}
+	b := &strings.Builder{}
+	for _, o := range r.objects {
+		fmt.Fprintf(b, "%s %s/%s:", o.Kind, o.Namespace, o.Name)
+		if o.Missing {
+			b.WriteString(" missing")
+		}
+		for _, f := range o.Fields {
+			fmt.Fprintf(b, " %s (desired %v, actual %v)", f.Path, f.Desired, f.Actual)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (r *DriftReport) reset(objects []ObjectDrift) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.objects = objects
+}
+
+// managedPath converts the path of the managed fields to the one used to match the
+// fields in drift, e.g. spec.template.spec.containers[1].image. The keys and values of
+// the list elements are resolved to the indexes of the desired items, and false is
+// returned if the element isn't desired, as none of its fields drift then.
+func managedPath(p fieldpath.Path, desired interface{}) (string, bool) {
+	b := &strings.Builder{}
+	v := desired
+	for _, e := range p {
+		if e.FieldName != nil {
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(*e.FieldName)
+			m, _ := v.(map[string]interface{})
+			v = m[*e.FieldName]
+			continue
+		}
+		items, _ := v.([]interface{})
+		i := listIndex(e, items)
+		if i < 0 {
+			return "", false
+		}
+		fmt.Fprintf(b, "[%d]", i)
+		v = items[i]
+	}
+	return b.String(), true
+}
+
+// listIndex returns the index of the item matching the list element, or -1.
+func listIndex(e fieldpath.PathElement, items []interface{}) int {
+	if e.Index != nil {
+		if *e.Index < len(items) {
+			return *e.Index
+		}
+		return -1
+	}
+	for i, item := range items {
+		switch {
+		case e.Key != nil:
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			matched := true
+			for _, k := range *e.Key {
+				if !equalJSON(k.Value.Unstructured(), m[k.Name]) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return i
+			}
+		case e.Value != nil:
+			if equalJSON((*e.Value).Unstructured(), item) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// equalJSON compares the values by their JSON, as the numbers of the managed fields
+// are int64 while the ones of the desired objects are float64.
+func equalJSON(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(x, y)
+}
+
+// ignoredFields returns the fields owned by the managers ignored: the ones applied by
+// other managers, and the ones of the managers set by IgnoreManagers.
+func ignoredFields(live client.Object, desired map[string]interface{}, owner string, managers map[string]bool) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	for _, entry := range live.GetManagedFields() {
+		if entry.Manager == owner || entry.FieldsV1 == nil {
+			continue
+		}
+		if entry.Operation != metav1.ManagedFieldsOperationApply && !managers[entry.Manager] {
+			continue
+		}
+		set := &fieldpath.Set{}
+		if err := set.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+			return nil, err
+		}
+		set.Iterate(func(p fieldpath.Path) {
+			if path, ok := managedPath(p, desired); ok {
+				fields[path] = true
+			}
+		})
+	}
+	return fields, nil
+}
+
+// isIgnored returns true if the field or any of its parents is ignored.
+func isIgnored(path string, ignored map[string]bool) bool {
+	for i := 0; i < len(path); i++ {
+		if (path[i] == '.' || path[i] == '[') && ignored[path[:i]] {
+			return true
+		}
+	}
+	return ignored[path]
+}
+
+// isEmpty returns true for empty maps and lists, which match the missing fields.
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// compareFields compares the fields set in desired with the actual ones. Fields not set
+// in desired, e.g. the ones defaulted by the server, are ignored.
+func compareFields(path string, desired, actual interface{}, drifts []FieldDrift) []FieldDrift {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			if actual == nil && isEmpty(d) {
+				return drifts
+			}
+			return append(drifts, FieldDrift{Path: path, Desired: desired, Actual: actual})
+		}
+		for k, v := range d {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			drifts = compareFields(p, v, a[k], drifts)
+		}
+		return drifts
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(d) {
+			if actual == nil && isEmpty(d) {
+				return drifts
+			}
+			return append(drifts, FieldDrift{Path: path, Desired: desired, Actual: actual})
+		}
+		for i := range d {
+			drifts = compareFields(fmt.Sprintf("%s[%d]", path, i), d[i], a[i], drifts)
+		}
+		return drifts
+	default:
+		if !reflect.DeepEqual(desired, actual) {
+			drifts = append(drifts, FieldDrift{Path: path, Desired: desired, Actual: actual})
+		}
+		return drifts
+	}
+}
+
+type driftOptions struct {
+	managers map[string]bool
+	event    bool
+}
+
+// DriftOption configures DetectDrift.
+type DriftOption func(o *driftOptions)
+
+// IgnoreManagers ignores the fields owned by the managers, e.g. the ones scaling the
+// workloads, besides the fields applied by other managers.
+func IgnoreManagers(managers ...string) DriftOption {
+	return func(o *driftOptions) {
+		for _, m := range managers {
+			o.managers[m] = true
+		}
+	}
+}
+
+// EmitDriftEvent emits a Warning event with reason DriftDetected to the object set by
+// WithEvents when any drift is detected.
+func EmitDriftEvent() DriftOption {
+	return func(o *driftOptions) {
+		o.event = true
+	}
+}
+
+type detectDrift struct {
+	report  *DriftReport
+	desired ChildrenFunc
+	options driftOptions
+}
+
+func (s *detectDrift) Name() string {
+	return "DetectDrift"
+}
+
+func (s *detectDrift) detect(rc ReconcileContext, obj client.Object) (*ObjectDrift, error) {
+	gvk, err := apiutil.GVKForObject(obj, rc.Scheme())
+	if err != nil {
+		return nil, err
+	}
+	drift := &ObjectDrift{Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(gvk)
+	if err := rc.Client().Get(rc.Context(), client.ObjectKeyFromObject(obj), live); err != nil {
+		if apierrors.IsNotFound(err) {
+			drift.Missing = true
+			return drift, nil
+		}
+		return nil, err
+	}
+
+	desired, err := normalizedJSON(obj, gvk)
+	if err != nil {
+		return nil, err
+	}
+	delete(desired, "apiVersion")
+	delete(desired, "kind")
+
+	// Round trip through JSON, so the numbers are of the same type as desired.
+	data, err := json.Marshal(live.Object)
+	if err != nil {
+		return nil, err
+	}
+	var actual map[string]interface{}
+	if err := json.Unmarshal(data, &actual); err != nil {
+		return nil, err
+	}
+
+	ignored, err := ignoredFields(live, desired, string(rc.Owner()), s.options.managers)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range compareFields("", desired, actual, nil) {
+		if !isIgnored(f.Path, ignored) {
+			drift.Fields = append(drift.Fields, f)
+		}
+	}
+	sort.Slice(drift.Fields, func(i, j int) bool {
+		return drift.Fields[i].Path < drift.Fields[j].Path
+	})
+	return drift, nil
+}
+
+func (s *detectDrift) Execute(rc ReconcileContext, f Flow) (reconcile.Result, error) {
+	objects, err := s.desired(rc)
+	if err != nil {
+		return f.Error(err, "Failed to build desired objects.")
+	}
+
+	drifts := make([]ObjectDrift, 0)
+	for _, obj := range objects {
+		drift, err := s.detect(rc, obj)
+		if err != nil {
+			return f.Error(err, "Failed to detect drift.", "name", obj.GetName())
+		}
+		if drift.Missing || len(drift.Fields) > 0 {
+			drifts = append(drifts, *drift)
+		}
+	}
+	s.report.reset(drifts)
+
+	if len(drifts) == 0 {
+		return f.Pass()
+	}
+	f.Logger().Info("Drift detected.", "report", s.report.String())
+	if inner, ok := f.(*flow); ok && s.options.event {
+		inner.activeEvents().emit(corev1.EventTypeWarning, EventReasonDriftDetected, driftMessage(drifts))
+	}
+	return f.Pass()
+}
+
+func driftMessage(drifts []ObjectDrift) string {
+	objects := make([]string, 0, len(drifts))
+	for _, d := range drifts {
+		fields := make([]string, 0, len(d.Fields))
+		for _, f := range d.Fields {
+			fields = append(fields, f.Path)
+		}
+		if d.Missing {
+			fields = append(fields, "missing")
+		}
+		objects = append(objects, fmt.Sprintf("%s %s (%s)", d.Kind, d.Name, strings.Join(fields, ", ")))
+	}
+	return "Drift detected in " + strings.Join(objects, ", ") + "."
+}
+
+// DetectDrift compares the desired objects with the live ones, and writes the drifted
+// fields into the report without changing anything. Only the fields set in the desired
+// objects are compared, so the fields defaulted by the server are ignored, and so are
+// the fields applied by other managers. The report is reset every time the step is
+// executed, and the flow always continues unless the objects can't be read.
+func DetectDrift(report *DriftReport, desired ChildrenFunc, opts ...DriftOption) BindFunc {
+	s := &detectDrift{report: report, desired: desired, options: driftOptions{managers: map[string]bool{}}}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	return NewStepBinder(s)
+}
@@ -0,0 +1,101 @@
+package kube_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sqc157400661/helper/kube"
+	"github.com/sqc157400661/helper/kube/kubetest"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDetectDrift(t *testing.T) {
+	deployment := func(replicas int32, team string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Labels: map[string]string{"team": team}},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: pointer.Int32(replicas),
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "app:v1"}},
+				}},
+			},
+		}
+	}
+	live := deployment(5, "b")
+	// Defaulted by the server.
+	live.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+	// The label is applied by another manager.
+	live.ManagedFields = []metav1.ManagedFieldsEntry{{
+		Manager:    "others",
+		Operation:  metav1.ManagedFieldsOperationApply,
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:team":{}}}}`)},
+	}}
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "default"}}
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(owner, live))
+
+	report := &kube.DriftReport{}
+	kubetest.Run(t, rc, kube.DetectDrift(report, func(rc kube.ReconcileContext) ([]client.Object, error) {
+		missing := deployment(1, "a")
+		missing.Name = "missing"
+		return []client.Object{deployment(3, "a"), missing}, nil
+	}, kube.EmitDriftEvent())).ExpectContinue()
+
+	assert.True(t, report.HasDrift())
+	objects := report.Objects()
+	assert.Len(t, objects, 2)
+	assert.Equal(t, []kube.FieldDrift{{Path: "spec.replicas", Desired: float64(3), Actual: float64(5)}}, objects[0].Fields)
+	assert.True(t, objects[1].Missing)
+	rc.ExpectNoWrites(t)
+
+	// Events are emitted to the object set by WithEvents.
+	task := kube.NewTask()
+	kube.DetectDrift(report, func(rc kube.ReconcileContext) ([]client.Object, error) {
+		return []client.Object{deployment(3, "a")}, nil
+	}, kube.EmitDriftEvent())(task)
+	kubetest.RunTask(t, rc, task, kube.WithEvents(owner)).ExpectContinue()
+	events := rc.Events()
+	assert.Len(t, events, 1)
+	assert.True(t, strings.HasPrefix(events[0], "Warning DriftDetected Drift detected in Deployment app (spec.replicas)"), events[0])
+}
+
+func TestDetectDriftKeyedFields(t *testing.T) {
+	deployment := func(app, sidecar string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: app}, {Name: "sidecar", Image: sidecar}},
+				}},
+			},
+		}
+	}
+	live := deployment("app:v0", "sidecar:v2")
+	// Only the image of the sidecar is applied by another manager.
+	live.ManagedFields = []metav1.ManagedFieldsEntry{{
+		Manager:    "injector",
+		Operation:  metav1.ManagedFieldsOperationApply,
+		FieldsType: "FieldsV1",
+		FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:template":{"f:spec":{"f:containers":{` +
+			`"k:{\"name\":\"sidecar\"}":{".":{},"f:image":{},"f:name":{}}}}}}}`)},
+	}}
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(live))
+
+	report := &kube.DriftReport{}
+	kubetest.Run(t, rc, kube.DetectDrift(report, func(rc kube.ReconcileContext) ([]client.Object, error) {
+		return []client.Object{deployment("app:v1", "sidecar:v1")}, nil
+	})).ExpectContinue()
+
+	objects := report.Objects()
+	assert.Len(t, objects, 1)
+	assert.Equal(t, []kube.FieldDrift{{
+		Path:    "spec.template.spec.containers[0].image",
+		Desired: "app:v1",
+		Actual:  "app:v0",
+	}}, objects[0].Fields)
+}
@@ -0,0 +1,93 @@
+package kube
+
+import (
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	EventReasonStepFailed = "StepFailed"
+	EventReasonStepPanic  = "StepPanic"
+)
+
+// eventEmitter emits events of a run to the object, and drops the duplicated ones.
+type eventEmitter struct {
+	object   runtime.Object
+	recorder record.EventRecorder
+
+	mu      sync.Mutex
+	emitted map[string]bool
+}
+
+func (e *eventEmitter) emit(eventType, reason, message string) {
+	if e == nil || e.recorder == nil {
+		return
+	}
+
+	key := eventType + "/" + reason + "/" + message
+	e.mu.Lock()
+	if e.emitted[key] {
+		e.mu.Unlock()
+		return
+	}
+	e.emitted[key] = true
+	e.mu.Unlock()
+
+	e.recorder.Event(e.object, eventType, reason, message)
+}
+
+type milestoneStep struct {
+	Step
+	reason  string
+	message string
+}
+
+func (s *milestoneStep) Execute(rc ReconcileContext, f Flow) (reconcile.Result, error) {
+	inner, ok := f.(*flow)
+	if !ok || inner.events == nil {
+		return s.Step.Execute(rc, f)
+	}
+
+	// Only count the breaks and errors happening in the step.
+	broken, prevErr := inner.BreakLoop(), inner.stepErr()
+	result, err := s.Step.Execute(rc, f)
+	if err == nil && inner.stepErr() == prevErr && (broken || !inner.BreakLoop()) {
+		inner.activeEvents().emit(corev1.EventTypeNormal, s.reason, s.message)
+	}
+	return result, err
+}
+
+// Milestone marks the steps of the binders as milestones, which emit a Normal event with
+// the reason and message when they continue. Events are only emitted by executors with
+// WithEvents.
+func Milestone(reason, message string, binders ...BindFunc) BindFunc {
+	return func(t *Task, deferred ...bool) {
+		for _, step := range ExtractStepsFromBindFunc(binders...) {
+			NewStepBinder(&milestoneStep{Step: step, reason: reason, message: message})(t, deferred...)
+		}
+	}
+}
+
+// WithEvents emits events to the object with rc.Recorder(): Warning events for steps
+// ending with Flow.Error or Flow.RetryErr and panics, and Normal events for the steps
+// marked by Milestone. Duplicated events are dropped within a run.
+func WithEvents(object runtime.Object) ExecutorOption {
+	return func(e *executor) {
+		e.events = &eventEmitter{
+			object:  object,
+			emitted: make(map[string]bool),
+		}
+		if f, ok := e.flow.(*flow); ok {
+			f.events = e.events
+		}
+	}
+}
+
+func stepFailedMessage(step string, err error) string {
+	return fmt.Sprintf("Step %s failed: %s", step, err.Error())
+}
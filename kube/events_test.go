@@ -0,0 +1,102 @@
+package kube
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type recorderReconcileContext struct {
+	testReconcileContext
+	recorder record.EventRecorder
+}
+
+func (rc *recorderReconcileContext) Recorder() record.EventRecorder {
+	return rc.recorder
+}
+
+func TestWithEvents(t *testing.T) {
+	pass := func(name string) BindFunc {
+		return NewStepBinder(NewStep(name, func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			return flow.Pass()
+		}))
+	}
+	fail := NewStepBinder(NewStep("fail", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		return flow.Error(errors.New("boom"), "Failed.")
+	}))
+	retryErr := NewStepBinder(NewStep("retry", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		return flow.RetryErr(errors.New("conflict"), "Retry.")
+	}))
+	panics := NewStepBinder(NewStep("panic", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		panic("boom")
+	}))
+
+	testCases := []struct {
+		name    string
+		binders []BindFunc
+		events  []string
+	}{
+		{
+			name:    "milestone",
+			binders: []BindFunc{Milestone("Synced", "Synced.", pass("sync"))},
+			events:  []string{"Normal Synced Synced."},
+		},
+		{
+			name:    "duplicated milestones",
+			binders: []BindFunc{Milestone("Synced", "Synced.", pass("a"), pass("b"))},
+			events:  []string{"Normal Synced Synced."},
+		},
+		{
+			name:    "milestone failed",
+			binders: []BindFunc{Milestone("Synced", "Synced.", fail)},
+			events:  []string{"Warning StepFailed Step fail failed: boom"},
+		},
+		{
+			name:    "milestone broken",
+			binders: []BindFunc{Milestone("Synced", "Synced.", Wait("wait")), pass("after")},
+			events:  nil,
+		},
+		{
+			name:    "retry error",
+			binders: []BindFunc{retryErr},
+			events:  []string{"Warning StepFailed Step retry failed: conflict"},
+		},
+		{
+			name: "duplicated failures",
+			binders: []BindFunc{func(t *Task, deferred ...bool) {
+				fail(t, true)
+				fail(t, true)
+			}},
+			events: []string{"Warning StepFailed Step fail failed: boom"},
+		},
+		{
+			name:    "panic",
+			binders: []BindFunc{panics},
+			events:  []string{"Warning StepPanic Panic detected: boom"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(16)
+			task := NewTask()
+			for _, b := range tc.binders {
+				b(task)
+			}
+			_, _ = NewExecutor(logr.Discard(), WithEvents(&corev1.ConfigMap{})).
+				Execute(&recorderReconcileContext{recorder: recorder}, task)
+
+			close(recorder.Events)
+			var events []string
+			for e := range recorder.Events {
+				events = append(events, e)
+			}
+			assert.Equal(t, tc.events, events)
+		})
+	}
+}
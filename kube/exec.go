@@ -0,0 +1,197 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/util/exec"
+)
+
+// DefaultMaxOutputBytes is the default cap of the stdout and stderr captured by
+// PodExecWithResult.
+const DefaultMaxOutputBytes = 1 << 20
+
+// ExecResult is the result of PodExecWithResult.
+type ExecResult struct {
+	Stdout string
+	Stderr string
+	// ExitCode is the exit code of the command.
+	ExitCode int
+	// Duration is the duration of the last attempt.
+	Duration time.Duration
+	// Attempts is the number of the attempts.
+	Attempts int
+	// StdoutTruncated and StderrTruncated are true if the outputs exceed the cap.
+	StdoutTruncated bool
+	StderrTruncated bool
+}
+
+// cappedBuffer keeps the first max bytes written, and drops the rest silently so that
+// the stream is never broken.
+type cappedBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - len(b.buf); room < len(p) {
+		b.truncated = true
+		if room < 0 {
+			room = 0
+		}
+		p = p[:room]
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+// gatedWriter forwards the writes to w until it's closed, so that the stream abandoned
+// never writes to the writers of the caller after returning.
+type gatedWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closed bool
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+	return w.w.Write(p)
+}
+
+func (w *gatedWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+}
+
+// exitCode returns the exit code if the error is caused by a non-zero exit of the command.
+func exitCode(err error) (int, bool) {
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
+}
+
+// isTransientExecError returns true if the error is a transient stream error worth
+// retrying, e.g. a connection reset or a throttled request. The errors like a missing
+// container or a forbidden request are permanent.
+func isTransientExecError(err error) bool {
+	return utilnet.IsProbableEOF(err) || utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) ||
+		utilnet.IsTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err)
+}
+
+// execOnce executes the command once, and returns when the context is done. The context
+// is passed to podExec to close the stream, and the writers of the caller are detached
+// before returning, so a podExec ignoring the context never writes to them afterwards.
+func execOnce(ctx context.Context, opts ExecOptions, podExec func(ctx context.Context, opts ExecOptions) error) (*ExecResult, error) {
+	max := opts.MaxOutputBytes
+	if max <= 0 {
+		max = DefaultMaxOutputBytes
+	}
+	stdout, stderr := &cappedBuffer{max: max}, &cappedBuffer{max: max}
+	var gates []*gatedWriter
+	tee := func(buf *cappedBuffer, w io.Writer) io.Writer {
+		if w == nil {
+			return buf
+		}
+		gate := &gatedWriter{w: w}
+		gates = append(gates, gate)
+		return io.MultiWriter(buf, gate)
+	}
+	opts.Stdout, opts.Stderr = tee(stdout, opts.Stdout), tee(stderr, opts.Stderr)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- podExec(ctx, opts)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		for _, gate := range gates {
+			gate.close()
+		}
+		return nil, ctx.Err()
+	}
+
+	result := &ExecResult{
+		Duration:        time.Since(start),
+		StdoutTruncated: stdout.truncated,
+		StderrTruncated: stderr.truncated,
+	}
+	if code, ok := exitCode(err); ok {
+		result.ExitCode, err = code, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Stdout, result.Stderr = string(stdout.buf), string(stderr.buf)
+	return result, nil
+}
+
+// ExecWithResult executes the command with podExec, e.g. a PodExec bound to the pod and
+// container, and captures its result. podExec should close the stream once ctx is done.
+// See PodExecWithResult.
+func ExecWithResult(ctx context.Context, opts ExecOptions, podExec func(ctx context.Context, opts ExecOptions) error) (*ExecResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := execOnce(ctx, opts, podExec)
+		if err == nil {
+			result.Attempts = attempt
+			return result, nil
+		}
+		// Never retry with stdin, which can't be replayed.
+		if opts.Retry == nil || opts.Stdin != nil || ctx.Err() != nil || !isTransientExecError(err) {
+			return nil, err
+		}
+		if opts.Retry.MaxAttempts > 0 && attempt >= opts.Retry.MaxAttempts {
+			return nil, err
+		}
+
+		backoff := opts.Retry.Backoff(attempt)
+		if opts.Logger != nil {
+			opts.Logger.Info("Exec failed, retrying", "err", err.Error(), "attempt", attempt, "backoff", backoff)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// PodExecWithResult executes the command in the container of the pod and returns its
+// stdout, stderr, exit code and duration. A non-zero exit code is not an error, while
+// the failures to execute the command are errors, and the transient stream errors are
+// retried with opts.Retry when there's no stdin, up to its MaxAttempts where zero means
+// unlimited. The outputs are also written to opts.Stdout and opts.Stderr if set. When
+// ctx is done, the stream is closed and it returns ctx.Err().
+func (rc *DefaultReconcileHelper) PodExecWithResult(ctx context.Context, pod *corev1.Pod, container string, command []string, opts ExecOptions) (*ExecResult, error) {
+	return ExecWithResult(ctx, opts, func(ctx context.Context, opts ExecOptions) error {
+		return rc.podExec(ctx, pod, container, command, opts)
+	})
+}
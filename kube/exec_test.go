@@ -0,0 +1,97 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/exec"
+)
+
+func TestExecWithResult(t *testing.T) {
+	result, err := ExecWithResult(context.Background(), ExecOptions{MaxOutputBytes: 4}, func(ctx context.Context, opts ExecOptions) error {
+		_, _ = io.WriteString(opts.Stdout, "hello")
+		_, _ = io.WriteString(opts.Stderr, "oops")
+		return exec.CodeExitError{Err: errors.New("exit"), Code: 2}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Equal(t, "hell", result.Stdout)
+	assert.True(t, result.StdoutTruncated)
+	assert.Equal(t, "oops", result.Stderr)
+	assert.False(t, result.StderrTruncated)
+}
+
+func TestExecWithResultRetriesTransportErrors(t *testing.T) {
+	attempts := 0
+	policy := &RetryPolicy{InitialInterval: time.Millisecond, MaxAttempts: 3}
+	result, err := ExecWithResult(context.Background(), ExecOptions{Retry: policy}, func(ctx context.Context, opts ExecOptions) error {
+		attempts++
+		if attempts < 3 {
+			return io.ErrUnexpectedEOF
+		}
+		_, _ = io.WriteString(opts.Stdout, "ok")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Attempts)
+	assert.Equal(t, "ok", result.Stdout)
+
+	// Never retry with stdin.
+	attempts = 0
+	_, err = ExecWithResult(context.Background(), ExecOptions{Retry: policy, Stdin: strings.NewReader("x")}, func(ctx context.Context, opts ExecOptions) error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	// Never retry permanent errors.
+	attempts = 0
+	_, err = ExecWithResult(context.Background(), ExecOptions{Retry: policy}, func(ctx context.Context, opts ExecOptions) error {
+		attempts++
+		return errors.New("container main not found in pod p")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	// Zero max attempts means unlimited.
+	attempts = 0
+	unlimited := &RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+	result, err = ExecWithResult(context.Background(), ExecOptions{Retry: unlimited}, func(ctx context.Context, opts ExecOptions) error {
+		attempts++
+		if attempts < 5 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, result.Attempts)
+}
+
+func TestExecWithResultCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	release, exited := make(chan struct{}), make(chan struct{})
+	out := &strings.Builder{}
+	var streamCtx context.Context
+	_, err := ExecWithResult(ctx, ExecOptions{Stdout: out}, func(ctx context.Context, opts ExecOptions) error {
+		defer close(exited)
+		streamCtx = ctx
+		<-release
+		// Writes after returning are dropped.
+		_, _ = io.WriteString(opts.Stdout, "late")
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	<-exited
+	assert.Error(t, streamCtx.Err())
+	assert.Empty(t, out.String())
+}
@@ -1,11 +1,14 @@
 package kube
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -14,78 +17,145 @@ type Executor interface {
 }
 
 type executor struct {
-	logger logr.Logger
-	flow   innerFlow
-	tracer *tracer
-	debug  bool
+	logger   logr.Logger
+	flow     innerFlow
+	tracer   *tracer
+	exporter TraceExporter
+	metrics  *stepMetrics
+	plan     *Plan
+	events   *eventEmitter
+	debug    bool
+
+	metricsStepName func(name string) string
+
+	interceptors []StepInterceptor
+
+	conditionObject ObjectWithConditions
+	conditions      *conditionSet
+
+	stepTimeout time.Duration
 }
 
 func (e *executor) isDebugEnabled() bool {
 	return e.debug
 }
 
-func (e *executor) handlePanic(r interface{}) error {
-	var err error
-
-	// Extract error from panic
+// panicToError extracts error from the recovered value of panic.
+func panicToError(r interface{}) error {
 	switch r.(type) {
 	case error:
-		err = r.(error)
+		return r.(error)
 	case string:
-		err = fmt.Errorf(r.(string))
+		return fmt.Errorf(r.(string))
 	default:
-		err = fmt.Errorf("%+v", r)
+		return fmt.Errorf("%+v", r)
 	}
+}
+
+func (e *executor) handlePanic(r interface{}) error {
+	err := panicToError(r)
 	e.logger.Error(err, "Panic detected, recovered and return error")
+	e.events.emit(corev1.EventTypeWarning, EventReasonStepPanic, "Panic detected: "+err.Error())
 
 	return err
 }
 
-func (e *executor) prepare(rc ReconcileContext, step Step, log logr.Logger) {
+func (e *executor) prepare(rc ReconcileContext, step Step, log logr.Logger, parent *Span, deferred bool) *Span {
 	name := step.Name()
 
+	kind := SpanKindStep
+	if deferred {
+		kind = SpanKindDeferredStep
+	}
+	span := e.tracer.startSpan(parent, name, kind, "step", e.tracer.currentStepIndex())
+
 	log = log.WithValues("action", name, "step", e.tracer.currentStepIndex())
 	e.flow.SetLogger(log)
+	e.flow.beginStep(span, StepInfo{Name: name, Deferred: deferred})
 
 	if e.isDebugEnabled() || rc.Debug() {
 		log.WithName("trace").Info("BEGIN")
 	}
+
+	return span
 }
 
-func (e *executor) done(rc ReconcileContext, err error, deferred bool, last bool) {
+func (e *executor) outcome(err error, deferred bool, last bool) Outcome {
+	switch {
+	case err != nil:
+		return OutcomeError
+	case last:
+		return OutcomeComplete
+	case !deferred && e.flow.BreakLoop():
+		return OutcomeBreak
+	default:
+		return OutcomeContinue
+	}
+}
+
+// done ends the step. The failures of panicking steps are reported as panics by the
+// executor instead.
+func (e *executor) done(rc ReconcileContext, span *Span, err error, deferred bool, last bool, panicked bool) {
 	e.tracer.markStepDone()
 
+	// Errors reported by RetryErr are not returned.
+	if err == nil {
+		err = e.flow.stepErr()
+	}
+	outcome := e.outcome(err, deferred, last)
+	e.tracer.endSpan(span, outcome, err)
+	e.metrics.observe(e.metricsStepName(span.Name), outcome, deferred, time.Since(span.Start))
+	if outcome == OutcomeError && !panicked {
+		e.events.emit(corev1.EventTypeWarning, EventReasonStepFailed, stepFailedMessage(span.Name, err))
+	}
+
 	if e.isDebugEnabled() || rc.Debug() {
 		log := e.flow.Logger().WithName("trace")
-		if err != nil {
+		switch {
+		case outcome == OutcomeError:
 			log.Info("ERROR", "err", err.Error())
-		} else if last {
+		case outcome == OutcomeComplete:
 			log.Info("COMPLETE")
-		} else if deferred {
+		case deferred:
 			log.Info("CONTINUE [DEFER]")
-		} else if e.flow.BreakLoop() {
-			log.Info("BREAK")
-		} else {
-			log.Info("CONTINUE")
+		default:
+			log.Info(string(outcome))
 		}
 	}
 }
 
-func (e *executor) execute(rc ReconcileContext, step Step, log logr.Logger, deferred bool, last bool) (result reconcile.Result, err error) {
-	e.prepare(rc, step, log)
+func (e *executor) execute(rc ReconcileContext, step Step, log logr.Logger, parent *Span, deferred bool, last bool) (result reconcile.Result, err error) {
+	span := e.prepare(rc, step, log, parent, deferred)
 
-	defer e.done(rc, err, deferred, last)
+	defer func() {
+		if r := recover(); r != nil {
+			e.metrics.observePanic(e.metricsStepName(span.Name))
+			e.done(rc, span, panicToError(r), deferred, last, true)
+			panic(r)
+		}
+		e.done(rc, span, err, deferred, last, false)
+	}()
 
-	return step.Execute(rc, e.flow)
+	execute := func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		// Steps with their own timeouts take care of themselves.
+		if !hasTimeout(step) && e.stepTimeout > 0 {
+			return NewStepWithTimeout(step, e.stepTimeout).Execute(rc, flow)
+		}
+		return step.Execute(rc, flow)
+	}
+	for i := len(e.interceptors) - 1; i >= 0; i-- {
+		execute = e.interceptors[i](execute)
+	}
+	return execute(rc, e.flow)
 }
 
-func (e *executor) executeDeferredSteps(rc ReconcileContext, task *Task) error {
+func (e *executor) executeDeferredSteps(rc ReconcileContext, task *Task, parent *Span) error {
 	log := e.logger.WithValues("defer_exec", true)
 
 	errs := make([]string, 0)
 	for task.hasNextDeferredStep() {
 		step := task.nextDeferredStep()
-		_, err := e.execute(rc, step, log, true, !task.hasNextDeferredStep())
+		_, err := e.execute(rc, step, log, parent, true, !task.hasNextDeferredStep())
 
 		// Never breaks the reconciliation flow, each deferred step will be executed.
 		if err != nil {
@@ -100,7 +170,50 @@ func (e *executor) executeDeferredSteps(rc ReconcileContext, task *Task) error {
 	return nil
 }
 
+// export ends the root span and exports the trace if an exporter is set.
+func (e *executor) export(rc ReconcileContext, root *Span, result reconcile.Result, err error) {
+	outcome := OutcomeComplete
+	if err != nil {
+		outcome = OutcomeError
+	} else if e.flow.BreakLoop() {
+		outcome = OutcomeBreak
+	}
+	e.tracer.endSpan(root, outcome, err,
+		"requeue", result.Requeue, "requeue-after", result.RequeueAfter)
+
+	trace := e.tracer.trace()
+	if e.plan != nil {
+		e.finishPlan(rc, trace)
+	}
+
+	if e.exporter == nil {
+		return
+	}
+	ctx := rc.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := e.exporter.ExportTrace(ctx, trace); err != nil {
+		e.logger.Error(err, "Failed to export trace.")
+	}
+}
+
 func (e *executor) Execute(rc ReconcileContext, task *Task) (result reconcile.Result, err error) {
+	if e.plan != nil {
+		rc = newDryRunContext(rc, e.plan)
+	}
+	if e.events != nil {
+		e.events.recorder = rc.Recorder()
+	}
+
+	root := e.tracer.startSpan(nil, "Reconcile", SpanKindReconcile,
+		"request", rc.Request().String())
+
+	// Export trace.
+	defer func() {
+		e.export(rc, root, result, err)
+	}()
+
 	// Handle panic.
 	defer func() {
 		if r := recover(); r != nil {
@@ -125,9 +238,22 @@ func (e *executor) Execute(rc ReconcileContext, task *Task) (result reconcile.Re
 		}
 	}()
 
+	// Handle status conditions.
+	if e.conditions != nil {
+		defer func() {
+			err1 := e.patchConditions(rc)
+			if err1 != nil {
+				e.logger.Error(err1, "Failed to patch status conditions.")
+				if err == nil {
+					err = err1
+				}
+			}
+		}()
+	}
+
 	// Handle deferred actions.
 	defer func() {
-		err1 := e.executeDeferredSteps(rc, task)
+		err1 := e.executeDeferredSteps(rc, task, root)
 		if err1 != nil {
 			err = err1
 		}
@@ -136,7 +262,7 @@ func (e *executor) Execute(rc ReconcileContext, task *Task) (result reconcile.Re
 	// Execute steps.
 	for task.hasNextStep() {
 		step := task.nextStep()
-		result, err = e.execute(rc, step, e.logger, false, !task.hasNextStep() && !task.hasNextDeferredStep())
+		result, err = e.execute(rc, step, e.logger, root, false, !task.hasNextStep() && !task.hasNextDeferredStep())
 		if e.flow.BreakLoop() {
 			return
 		}
@@ -151,15 +277,36 @@ func Debug(e *executor) {
 	e.debug = true
 }
 
+// WithStepTimeout sets the default timeout of every step, including the deferred ones.
+// Each step is executed with a context derived from rc.Context() with its own budget,
+// and must honour it. Use NewStepWithTimeout or Timeout to override it for some steps.
+func WithStepTimeout(d time.Duration) ExecutorOption {
+	return func(e *executor) {
+		e.stepTimeout = d
+	}
+}
+
+// WithTraceExporter exports the trace of the run with the exporter. A trace consists
+// of a root span of the reconcile and a child span per step (including the deferred
+// steps, the steps executed in parallel and the evaluation of conditions).
+func WithTraceExporter(exporter TraceExporter) ExecutorOption {
+	return func(e *executor) {
+		e.exporter = exporter
+	}
+}
+
 func NewExecutor(logger logr.Logger, opts ...ExecutorOption) Executor {
 	tracer := newTracer()
 
 	exec := &executor{
-		logger: logger.WithValues("trace", tracer.id),
-		tracer: tracer,
+		logger:          logger.WithValues("trace", tracer.id),
+		tracer:          tracer,
+		metricsStepName: StepKind,
 	}
 
-	exec.flow = newFlow(exec.logger)
+	flow := newFlow(exec.logger)
+	flow.tracer = tracer
+	exec.flow = flow
 
 	for _, opt := range opts {
 		opt(exec)
@@ -0,0 +1,94 @@
+package kube
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// patchMetadata patches the metadata, e.g. the finalizers, of the object with the optimistic
+// lock, so the changes made by others in the meantime are never overwritten.
+func patchMetadata(rc ReconcileContext, obj client.Object, mutate func() bool) error {
+	before := obj.DeepCopyObject().(client.Object)
+	if !mutate() {
+		return nil
+	}
+	return rc.Patch(obj, client.MergeFromWithOptions(before, client.MergeFromWithOptimisticLock{}))
+}
+
+type ensureFinalizer struct {
+	obj       client.Object
+	finalizer string
+}
+
+func (s *ensureFinalizer) Name() string {
+	return "EnsureFinalizer(" + s.finalizer + ")"
+}
+
+func (s *ensureFinalizer) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	// Never add finalizers to objects being deleted.
+	if s.obj.GetDeletionTimestamp() != nil {
+		return flow.Pass()
+	}
+
+	err := patchMetadata(rc, s.obj, func() bool {
+		return controllerutil.AddFinalizer(s.obj, s.finalizer)
+	})
+	if err != nil {
+		return flow.RetryErr(err, "Failed to add finalizer.", "finalizer", s.finalizer)
+	}
+	return flow.Pass()
+}
+
+// EnsureFinalizer adds the finalizer to the object if it's not being deleted. The object
+// should be loaded by the previous steps. The finalizers are patched with the field owner
+// of the context and the optimistic lock.
+func EnsureFinalizer(obj client.Object, finalizer string) BindFunc {
+	return NewStepBinder(&ensureFinalizer{obj: obj, finalizer: finalizer})
+}
+
+type onDeletion struct {
+	obj       client.Object
+	finalizer string
+	binders   []BindFunc
+}
+
+func (s *onDeletion) Name() string {
+	return "OnDeletion(" + s.finalizer + ")"
+}
+
+func (s *onDeletion) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	if s.obj.GetDeletionTimestamp() == nil {
+		return flow.Pass()
+	}
+
+	// Cleanup is done if the finalizer has been removed.
+	if !controllerutil.ContainsFinalizer(s.obj, s.finalizer) {
+		return flow.Break("Object is being deleted.")
+	}
+
+	result, err := executeBlock(rc, flow, ExtractStepsFromBindFunc(s.binders...), "cleanup")
+	if err != nil {
+		return result, err
+	}
+	if inner, ok := flow.(innerFlow); ok && inner.BreakLoop() {
+		return result, err
+	}
+
+	err = patchMetadata(rc, s.obj, func() bool {
+		return controllerutil.RemoveFinalizer(s.obj, s.finalizer)
+	})
+	if err != nil {
+		return flow.RetryErr(err, "Failed to remove finalizer.", "finalizer", s.finalizer)
+	}
+	return flow.Break("Cleanup finished, finalizer removed.")
+}
+
+// OnDeletion switches the task into the deletion branch when the object is being deleted:
+// it executes the steps of the cleanup binders in order, removes the finalizer after all
+// of them succeed, and then breaks the flow, so the steps after it are only executed when
+// the object is not being deleted. The finalizer is kept, and the cleanup is retried, if
+// any of the steps fails or breaks the flow. The cleanup binders are bound lazily.
+func OnDeletion(obj client.Object, finalizer string, cleanup ...BindFunc) BindFunc {
+	return NewStepBinder(&onDeletion{obj: obj, finalizer: finalizer, binders: cleanup})
+}
@@ -0,0 +1,80 @@
+package kube_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sqc157400661/helper/kube"
+	"github.com/sqc157400661/helper/kube/kubetest"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const testFinalizer = "example.com/cleanup"
+
+func finalizerTask(obj *corev1.ConfigMap, cleanup kube.ExecuteFunc, cleaned *bool) []kube.BindFunc {
+	return []kube.BindFunc{
+		kube.NewStepBinder(kube.NewStep("load", func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+			obj.Name, obj.Namespace = rc.Name(), rc.Namespace()
+			if err := rc.Get(obj); err != nil {
+				return flow.Error(err, "Failed to load.")
+			}
+			return flow.Pass()
+		})),
+		kube.OnDeletion(obj, testFinalizer, kube.NewStepBinder(kube.NewStep("cleanup", cleanup))),
+		kube.EnsureFinalizer(obj, testFinalizer),
+		kube.NewStepBinder(kube.NewStep("sync", func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+			*cleaned = false
+			return flow.Pass()
+		})),
+	}
+}
+
+func TestEnsureFinalizer(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default", Finalizers: []string{"others"}},
+	}))
+
+	obj, cleaned := &corev1.ConfigMap{}, true
+	kubetest.Run(t, rc, finalizerTask(obj, nil, &cleaned)...).ExpectContinue()
+	assert.False(t, cleaned)
+	rc.ExpectPatched(t, obj)
+
+	live := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}
+	assert.NoError(t, rc.Get(live))
+	assert.Equal(t, []string{"others", testFinalizer}, live.Finalizers)
+}
+
+func TestOnDeletion(t *testing.T) {
+	now := metav1.Now()
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cm", Namespace: "default", DeletionTimestamp: &now,
+			Finalizers: []string{"others", testFinalizer},
+		},
+	}))
+
+	obj, cleaned := &corev1.ConfigMap{}, false
+	failing := true
+	cleanup := func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+		if failing {
+			return flow.Error(errors.New("boom"), "Failed to clean up.")
+		}
+		cleaned = true
+		return flow.Pass()
+	}
+
+	// The finalizer is kept when the cleanup fails.
+	kubetest.Run(t, rc, finalizerTask(obj, cleanup, &cleaned)...).ExpectError()
+	rc.ExpectNoWrites(t)
+
+	failing = false
+	kubetest.Run(t, rc, finalizerTask(obj, cleanup, &cleaned)...).ExpectBreak()
+	assert.True(t, cleaned)
+
+	live := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}
+	assert.NoError(t, rc.Get(live))
+	assert.Equal(t, []string{"others"}, live.Finalizers)
+}
@@ -1,6 +1,8 @@
 package kube
 
 import (
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -36,7 +38,8 @@ type Flow interface {
 	Error(err error, msg string, kvs ...interface{}) (reconcile.Result, error)
 
 	// RetryErr is like Error but without returning error to the controller framework, but
-	// give it a chance to retry later. Default retry period is 1s.
+	// give it a chance to retry later. Default retry period is 1s, steps wrapped by
+	// WithRetryPolicy follow their policies instead.
 	RetryErr(err error, msg string, kvs ...interface{}) (reconcile.Result, error)
 
 	// WithLogger return a flow binding to the old but with a new logger.
@@ -53,27 +56,54 @@ type innerFlow interface {
 	// SetLogger set the logger.
 	SetLogger(logr.Logger)
 
+	// beginStep resets the state of the previous step and starts tracing in the span.
+	beginStep(span *Span, step StepInfo)
+
+	// stepErr returns the error reported by Error or RetryErr in the current step.
+	stepErr() error
+
 	Flow
 }
 
+// flowState is the state shared by a flow and all the flows derived from it.
+type flowState struct {
+	breakLoop bool
+	err       error
+
+	// abandoned is set once the steps executing on the flow are abandoned, e.g. after
+	// timeouts, so they never count the attempts of the retry policies, trace, report
+	// conditions or emit events anymore. It's inherited by the flows forked from it.
+	abandoned atomic.Bool
+	parent    *flowState
+}
+
 type flow struct {
 	retryAfter time.Duration
-	breakLoop  *bool
+	retry      *retryState
+	state      *flowState
 	logger     logr.Logger
+	tracer     *tracer
+	span       *Span
+	step       StepInfo
+	conditions *conditionSet
+	events     *eventEmitter
+}
+
+func (f *flow) clone() *flow {
+	c := *f
+	return &c
 }
 
 func (f *flow) WithLogger(log logr.Logger) Flow {
-	return &flow{
-		breakLoop: f.breakLoop,
-		logger:    log.WithCallDepth(1),
-	}
+	c := f.clone()
+	c.logger = log.WithCallDepth(1)
+	return c
 }
 
 func (f *flow) WithLoggerValues(keyAndValues ...interface{}) Flow {
-	return &flow{
-		breakLoop: f.breakLoop,
-		logger:    f.logger.WithValues(keyAndValues...),
-	}
+	c := f.clone()
+	c.logger = f.logger.WithValues(keyAndValues...)
+	return c
 }
 
 func (f *flow) Logger() logr.Logger {
@@ -81,11 +111,66 @@ func (f *flow) Logger() logr.Logger {
 }
 
 func (f *flow) markBreak() {
-	*f.breakLoop = true
+	f.state.breakLoop = true
 }
 
 func (f *flow) BreakLoop() bool {
-	return *f.breakLoop
+	return f.state.breakLoop
+}
+
+func (f *flow) beginStep(span *Span, step StepInfo) {
+	f.state.err = nil
+	f.span = span
+	f.step = step
+}
+
+func (f *flow) stepErr() error {
+	return f.state.err
+}
+
+// abandoned returns true if the steps executing on the flow, or on any flow it's forked
+// from, are abandoned.
+func (f *flow) abandoned() bool {
+	for s := f.state; s != nil; s = s.parent {
+		if s.abandoned.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// activeTracer returns the tracer of the flow, or nil once it's abandoned.
+func (f *flow) activeTracer() *tracer {
+	if f.abandoned() {
+		return nil
+	}
+	return f.tracer
+}
+
+// activeConditions returns the conditions of the flow, or nil once it's abandoned.
+func (f *flow) activeConditions() *conditionSet {
+	if f.abandoned() {
+		return nil
+	}
+	return f.conditions
+}
+
+// activeEvents returns the events of the flow, or nil once it's abandoned.
+func (f *flow) activeEvents() *eventEmitter {
+	if f.abandoned() {
+		return nil
+	}
+	return f.events
+}
+
+// merge merges the state of the child forked from the flow.
+func (f *flow) merge(child *flow) {
+	if child.state.breakLoop {
+		f.markBreak()
+	}
+	if child.state.err != nil {
+		f.state.err = child.state.err
+	}
 }
 
 func (f *flow) RetryAfter(duration time.Duration, msg string, kvs ...interface{}) (reconcile.Result, error) {
@@ -128,6 +213,7 @@ func (f *flow) Break(msg string, kvs ...interface{}) (reconcile.Result, error) {
 func (f *flow) Error(err error, msg string, kvs ...interface{}) (reconcile.Result, error) {
 	defer f.markBreak()
 
+	f.state.err = err
 	f.logger.Error(err, msg, kvs...)
 	return reconcile.Result{}, err
 }
@@ -135,19 +221,43 @@ func (f *flow) Error(err error, msg string, kvs ...interface{}) (reconcile.Resul
 func (f *flow) RetryErr(err error, msg string, kvs ...interface{}) (reconcile.Result, error) {
 	defer f.markBreak()
 
+	retryAfter := f.retryAfter
+	if f.retry != nil && !f.abandoned() {
+		attempt, backoff, exhausted := f.retry.next()
+		if exhausted {
+			return f.Error(fmt.Errorf("%w (after %d attempts)", err, attempt), msg, kvs...)
+		}
+		retryAfter = backoff
+		kvs = append(kvs, "attempt", attempt, "backoff", backoff)
+	}
+
+	f.state.err = err
 	f.logger.Error(err, msg, kvs...)
-	return reconcile.Result{RequeueAfter: f.retryAfter}, nil
+	return reconcile.Result{RequeueAfter: retryAfter}, nil
 }
 
 func (f *flow) SetLogger(l logr.Logger) {
 	f.logger = l
 }
 
+// forkFlow returns a flow with the settings of parent but an independent break state,
+// which is used by steps executing other steps concurrently.
+func forkFlow(parent Flow, l logr.Logger) *flow {
+	p, ok := parent.(*flow)
+	if !ok {
+		return newFlow(l)
+	}
+
+	f := p.clone()
+	f.state = &flowState{parent: p.state}
+	f.logger = l
+	return f
+}
+
 func newFlow(l logr.Logger) *flow {
-	breakLoop := false
 	return &flow{
 		retryAfter: 1 * time.Second,
-		breakLoop:  &breakLoop,
+		state:      &flowState{},
 		logger:     l,
 	}
 }
@@ -0,0 +1,203 @@
+package kube
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// GraphNode is a named node of a task graph, which executes the steps bound by its
+// binders in order.
+type GraphNode struct {
+	name      string
+	binders   []BindFunc
+	dependsOn []string
+}
+
+// DependsOn declares the nodes which must complete before the node.
+func (n *GraphNode) DependsOn(names ...string) *GraphNode {
+	n.dependsOn = append(n.dependsOn, names...)
+	return n
+}
+
+// Node returns a graph node with the given name and binders. The binders are bound
+// lazily when the node is executed.
+func Node(name string, binders ...BindFunc) *GraphNode {
+	return &GraphNode{
+		name:    name,
+		binders: binders,
+	}
+}
+
+type graph struct {
+	nodes  map[string]*GraphNode
+	levels [][]*GraphNode
+}
+
+func (g *graph) Name() string {
+	levels := make([]string, 0, len(g.levels))
+	for _, level := range g.levels {
+		names := make([]string, 0, len(level))
+		for _, n := range level {
+			names = append(names, n.name)
+		}
+		levels = append(levels, strings.Join(names, ","))
+	}
+	return "Graph(" + strings.Join(levels, ";") + ")"
+}
+
+// graphRun is the state of a node in an execution of the graph.
+type graphRun struct {
+	// done is closed once the node finishes or is skipped.
+	done    chan struct{}
+	outcome childOutcome
+	ran     bool
+	failed  bool
+}
+
+func (g *graph) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	runs := make(map[string]*graphRun, len(g.nodes))
+	for name := range g.nodes {
+		runs[name] = &graphRun{done: make(chan struct{})}
+	}
+
+	// Every node starts once its own dependencies finish.
+	var wg sync.WaitGroup
+	for _, level := range g.levels {
+		for _, n := range level {
+			run := runs[n.name]
+			child := forkFlow(flow, flow.Logger().WithValues("graph-node", n.name))
+			step := &block{name: n.name, binders: n.binders}
+
+			wg.Add(1)
+			go func(n *GraphNode) {
+				defer wg.Done()
+				defer close(run.done)
+
+				for _, dep := range n.dependsOn {
+					<-runs[dep].done
+					if runs[dep].failed {
+						// Skip the dependents of the failed too.
+						run.failed = true
+					}
+				}
+				if run.failed {
+					child.Logger().Info("Skip node as its dependencies break the flow.")
+					return
+				}
+				run.outcome = traceChild(rc, child, step)
+				run.ran = true
+				run.failed = run.outcome.failed()
+			}(n)
+		}
+	}
+	wg.Wait()
+
+	outcomes := make([]childOutcome, 0, len(g.nodes))
+	for _, level := range g.levels {
+		for _, n := range level {
+			if run := runs[n.name]; run.ran {
+				outcomes = append(outcomes, run.outcome)
+			}
+		}
+	}
+	return mergeOutcomes(flow, outcomes, "graph")
+}
+
+// sortGraph sorts the nodes into levels topologically, nodes in a level only depend on
+// nodes in the previous levels. It returns an error on duplicated or unknown nodes and
+// cycles.
+func sortGraph(nodes []*GraphNode) (map[string]*GraphNode, [][]*GraphNode, error) {
+	index := make(map[string]*GraphNode, len(nodes))
+	for _, n := range nodes {
+		if _, ok := index[n.name]; ok {
+			return nil, nil, fmt.Errorf("duplicated graph node %q", n.name)
+		}
+		index[n.name] = n
+	}
+
+	inDegrees := make(map[string]int, len(nodes))
+	dependents := make(map[string][]*GraphNode, len(nodes))
+	for _, n := range nodes {
+		for _, dep := range n.dependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, nil, fmt.Errorf("graph node %q depends on unknown node %q", n.name, dep)
+			}
+			inDegrees[n.name]++
+			dependents[dep] = append(dependents[dep], n)
+		}
+	}
+
+	levels := make([][]*GraphNode, 0)
+	current := make([]*GraphNode, 0)
+	for _, n := range nodes {
+		if inDegrees[n.name] == 0 {
+			current = append(current, n)
+		}
+	}
+	sorted := 0
+	for len(current) > 0 {
+		levels = append(levels, current)
+		sorted += len(current)
+
+		next := make([]*GraphNode, 0)
+		for _, n := range current {
+			for _, d := range dependents[n.name] {
+				inDegrees[d.name]--
+				if inDegrees[d.name] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		current = next
+	}
+
+	if sorted < len(nodes) {
+		cyclic := make([]string, 0)
+		for name, d := range inDegrees {
+			if d > 0 {
+				cyclic = append(cyclic, name)
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, nil, fmt.Errorf("cycle detected in graph among nodes: %s", strings.Join(cyclic, ", "))
+	}
+	return index, levels, nil
+}
+
+// NewGraphStep returns a step executing the nodes in topological order. Every node starts
+// once the nodes it depends on finish, so nodes without dependencies on each other are
+// executed concurrently, see NewParallelStep for the merging of results. When a node breaks the flow, the nodes
+// depending on it are skipped while the others still run, and the flow breaks after
+// all of them.
+func NewGraphStep(nodes ...*GraphNode) (Step, error) {
+	index, levels, err := sortGraph(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return &graph{
+		nodes:  index,
+		levels: levels,
+	}, nil
+}
+
+// Graph binds the nodes as a graph step, see NewGraphStep.
+func Graph(nodes ...*GraphNode) (BindFunc, error) {
+	step, err := NewGraphStep(nodes...)
+	if err != nil {
+		return nil, err
+	}
+	return NewStepBinder(step), nil
+}
+
+// MustGraph is like Graph but panics on errors.
+func MustGraph(nodes ...*GraphNode) BindFunc {
+	b, err := Graph(nodes...)
+	if err != nil {
+		panic("invalid graph: " + err.Error())
+	}
+	return b
+}
@@ -0,0 +1,90 @@
+package kube
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) step(name string) BindFunc {
+	return NewStepBinder(NewStep(name, func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.steps = append(r.steps, name)
+		return flow.Pass()
+	}))
+}
+
+func TestGraphValidation(t *testing.T) {
+	_, err := Graph(Node("a").DependsOn("b"), Node("b").DependsOn("c"), Node("c").DependsOn("a"), Node("d"))
+	assert.EqualError(t, err, "cycle detected in graph among nodes: a, b, c")
+
+	_, err = Graph(Node("a").DependsOn("x"))
+	assert.EqualError(t, err, `graph node "a" depends on unknown node "x"`)
+
+	_, err = Graph(Node("a"), Node("a"))
+	assert.EqualError(t, err, `duplicated graph node "a"`)
+}
+
+func TestGraphOrder(t *testing.T) {
+	r := &recorder{}
+	_, err := runTestTask(MustGraph(
+		Node("wait", r.step("wait")).DependsOn("sts", "svc"),
+		Node("sts", r.step("sts")).DependsOn("secret"),
+		Node("svc", r.step("svc")).DependsOn("secret"),
+		Node("secret", r.step("secret-1"), r.step("secret-2")),
+	))
+	assert.NoError(t, err)
+	assert.Len(t, r.steps, 5)
+	assert.Equal(t, []string{"secret-1", "secret-2"}, r.steps[:2])
+	assert.ElementsMatch(t, []string{"sts", "svc"}, r.steps[2:4])
+	assert.Equal(t, "wait", r.steps[4])
+}
+
+func TestGraphSkipsDependentsOfBreak(t *testing.T) {
+	r := &recorder{}
+	result, err := runTestTask(
+		MustGraph(
+			Node("a", RetryAfter(5, "a"), r.step("a")),
+			Node("b", r.step("b")).DependsOn("a"),
+			Node("c", r.step("c")).DependsOn("b"),
+			Node("d", r.step("d")),
+			Node("e", r.step("e")).DependsOn("d"),
+		),
+		r.step("after"),
+	)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, result.RequeueAfter)
+	assert.Equal(t, []string{"d", "e"}, r.steps)
+}
+
+func TestGraphStartsNodesOnTheirDependencies(t *testing.T) {
+	started := make(chan struct{})
+	slow := NewStepBinder(NewStep("slow", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		// Blocks until b starts, which never waits for the unrelated slow node.
+		select {
+		case <-started:
+			return flow.Pass()
+		case <-time.After(time.Second):
+			return flow.Error(errors.New("b not started"), "Timeout.")
+		}
+	}))
+	_, err := runTestTask(MustGraph(
+		Node("a", noopStep("a")),
+		Node("slow", slow),
+		Node("b", NewStepBinder(NewStep("b", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			close(started)
+			return flow.Pass()
+		}))).DependsOn("a"),
+	))
+	assert.NoError(t, err)
+}
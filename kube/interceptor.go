@@ -0,0 +1,34 @@
+package kube
+
+// StepInfo describes a step executed by the executor.
+type StepInfo struct {
+	// Name is the name of the step.
+	Name string
+	// Deferred is true if the step is a deferred one.
+	Deferred bool
+}
+
+// StepInterceptor wraps the execution of a step, e.g. to log, audit, or skip it. It could
+// pass a flow with extra logger values to next, or return without calling next to skip
+// the step. See CurrentStep for the step being executed.
+type StepInterceptor func(next ExecuteFunc) ExecuteFunc
+
+// WithInterceptors wraps the execution of every step of the task, including the deferred
+// ones, with the interceptors. The first interceptor is the outermost one. The steps
+// nested in other steps, e.g. the ones in Parallel, are executed by their parents and are
+// not intercepted.
+func WithInterceptors(interceptors ...StepInterceptor) ExecutorOption {
+	return func(e *executor) {
+		e.interceptors = append(e.interceptors, interceptors...)
+	}
+}
+
+// CurrentStep returns the step of the task being executed with the flow, which is the
+// outermost one for the nested steps. It returns an empty StepInfo if the flow is not
+// created by the executor.
+func CurrentStep(f Flow) StepInfo {
+	if inner, ok := f.(*flow); ok {
+		return inner.step
+	}
+	return StepInfo{}
+}
@@ -0,0 +1,59 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestInterceptors(t *testing.T) {
+	var calls []string
+	record := func(name string) StepInterceptor {
+		return func(next ExecuteFunc) ExecuteFunc {
+			return func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+				step := CurrentStep(flow)
+				calls = append(calls, name+":"+step.Name)
+				if step.Deferred {
+					calls = append(calls, name+":deferred")
+				}
+				return next(rc, flow.WithLoggerValues("interceptor", name))
+			}
+		}
+	}
+	skip := func(next ExecuteFunc) ExecuteFunc {
+		return func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			if CurrentStep(flow).Name == "disabled" {
+				return flow.Pass()
+			}
+			return next(rc, flow)
+		}
+	}
+
+	var executed []string
+	step := func(name string) BindFunc {
+		return NewStepBinder(NewStep(name, func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			executed = append(executed, name)
+			return flow.Pass()
+		}))
+	}
+
+	_, err := runTestTaskWithOptions(
+		[]ExecutorOption{WithInterceptors(record("outer"), record("inner")), WithInterceptors(skip)},
+		step("sync"),
+		step("disabled"),
+		func(task *Task, deferred ...bool) {
+			step("cleanup")(task, true)
+		},
+		Wait("Done."),
+		step("never"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sync", "cleanup"}, executed)
+	assert.Equal(t, []string{
+		"outer:sync", "inner:sync",
+		"outer:disabled", "inner:disabled",
+		"outer:Wait", "inner:Wait",
+		"outer:cleanup", "outer:deferred", "inner:cleanup", "inner:deferred",
+	}, calls)
+}
@@ -0,0 +1,285 @@
+// Package kubetest provides a fake ReconcileContext and assertions for unit-testing
+// the steps and tasks of the kube package.
+package kubetest
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sqc157400661/helper/kube"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DefaultOwner is the field owner of the fake reconcile context.
+const DefaultOwner client.FieldOwner = "kubetest"
+
+// helper is a reconcile helper backed by a fake client, with PodExec handled by a stub.
+type helper struct {
+	*kube.DefaultReconcileHelper
+	exec  *PodExecStub
+	logs  map[string]string
+	debug bool
+}
+
+func (h *helper) Debug() bool {
+	return h.debug
+}
+
+func (h *helper) PodExec(pod *corev1.Pod, container string, command []string, opts kube.ExecOptions) error {
+	return h.exec.PodExec(pod, container, command, opts)
+}
+
+func (h *helper) PodExecWithResult(ctx context.Context, pod *corev1.Pod, container string, command []string, opts kube.ExecOptions) (*kube.ExecResult, error) {
+	return kube.ExecWithResult(ctx, opts, func(ctx context.Context, opts kube.ExecOptions) error {
+		return h.exec.PodExec(pod, container, command, opts)
+	})
+}
+
+// CopyToPod streams the tar archive to the stub, which reads it from opts.Stdin. The
+// archive is drained if the handler doesn't read it.
+func (h *helper) CopyToPod(ctx context.Context, pod *corev1.Pod, container string, src, dst string, opts kube.CopyOptions) error {
+	return kube.CopyToPodWith(ctx, func(command []string, opts kube.ExecOptions) error {
+		if err := h.exec.PodExec(pod, container, command, opts); err != nil {
+			return err
+		}
+		_, err := io.Copy(io.Discard, opts.Stdin)
+		return err
+	}, src, dst, opts)
+}
+
+// CopyFromPod extracts the tar archive written by the stub to opts.Stdout.
+func (h *helper) CopyFromPod(ctx context.Context, pod *corev1.Pod, container string, src, dst string, opts kube.CopyOptions) error {
+	return kube.CopyFromPodWith(ctx, func(command []string, opts kube.ExecOptions) error {
+		return h.exec.PodExec(pod, container, command, opts)
+	}, src, dst, opts)
+}
+
+// PodLogs returns the logs set by WithPodLogs, with TailLines and LimitBytes applied.
+func (h *helper) PodLogs(ctx context.Context, pod *corev1.Pod, container string, opts kube.LogOptions) (string, error) {
+	logs, ok := h.logs[logsKey(pod.Namespace, pod.Name, container)]
+	if !ok {
+		return "", apierrors.NewNotFound(corev1.Resource("pods/log"), pod.Name)
+	}
+	if opts.TailLines > 0 {
+		lines := strings.SplitAfter(logs, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if n := len(lines) - int(opts.TailLines); n > 0 {
+			lines = lines[n:]
+		}
+		logs = strings.Join(lines, "")
+	}
+	if opts.LimitBytes > 0 && int64(len(logs)) > opts.LimitBytes {
+		logs = logs[:opts.LimitBytes]
+	}
+	return logs, nil
+}
+
+// StreamPodLogs delivers the lines of the logs set by WithPodLogs.
+func (h *helper) StreamPodLogs(ctx context.Context, pod *corev1.Pod, container string, opts kube.LogOptions, fn func(line string) error) error {
+	opts.LimitBytes = 0
+	logs, err := h.PodLogs(ctx, pod, container, opts)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(logs, "\n"), "\n") {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logsKey(namespace, pod, container string) string {
+	return namespace + "/" + pod + "/" + container
+}
+
+// FakeReconcileContext is a ReconcileContext backed by the fake client of
+// controller-runtime. All the writes are recorded, PodExec calls are handled by
+// a PodExecStub, and events are sent to a fake recorder.
+//
+// The fake client doesn't support server-side apply, so Apply always fails.
+type FakeReconcileContext struct {
+	*kube.BaseReconcileContext
+
+	helper *helper
+	client *kube.RecordingClient
+	events *eventLog
+}
+
+// eventLog collects the events from the fake recorder.
+type eventLog struct {
+	recorder *record.FakeRecorder
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) drain() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for {
+		select {
+		case e := <-l.recorder.Events:
+			l.events = append(l.events, e)
+		default:
+			return append([]string(nil), l.events...)
+		}
+	}
+}
+
+// WithContext returns a copy of the context bound to ctx, sharing the client, the
+// stub and the recorder.
+func (rc *FakeReconcileContext) WithContext(ctx context.Context) kube.ReconcileContext {
+	return &FakeReconcileContext{
+		BaseReconcileContext: rc.BaseReconcileContext.WithContext(ctx).(*kube.BaseReconcileContext),
+		helper:               rc.helper,
+		client:               rc.client,
+		events:               rc.events,
+	}
+}
+
+// Exec returns the stub handling the PodExec calls.
+func (rc *FakeReconcileContext) Exec() *PodExecStub {
+	return rc.helper.exec
+}
+
+// Writes returns the writes sent to the client so far.
+func (rc *FakeReconcileContext) Writes() []kube.PlannedWrite {
+	return rc.client.Writes()
+}
+
+// Events returns the events recorded so far, formatted as "<type> <reason> <message>".
+func (rc *FakeReconcileContext) Events() []string {
+	return rc.events.drain()
+}
+
+type options struct {
+	scheme            *runtime.Scheme
+	objects           []client.Object
+	request           *types.NamespacedName
+	owner             client.FieldOwner
+	debug             bool
+	forceRequeueAfter time.Duration
+	exec              *PodExecStub
+	logs              map[string]string
+}
+
+// Option configures the fake reconcile context.
+type Option func(o *options)
+
+// WithScheme sets the scheme of the fake client. It defaults to a scheme with all
+// the built-in types of client-go.
+func WithScheme(scheme *runtime.Scheme) Option {
+	return func(o *options) {
+		o.scheme = scheme
+	}
+}
+
+// WithObjects adds the objects to the fake client.
+func WithObjects(objs ...client.Object) Option {
+	return func(o *options) {
+		o.objects = append(o.objects, objs...)
+	}
+}
+
+// WithRequest sets the reconcile request. It defaults to the key of the first object
+// added by WithObjects.
+func WithRequest(namespace, name string) Option {
+	return func(o *options) {
+		o.request = &types.NamespacedName{Namespace: namespace, Name: name}
+	}
+}
+
+// WithOwner sets the field owner of the context.
+func WithOwner(owner client.FieldOwner) Option {
+	return func(o *options) {
+		o.owner = owner
+	}
+}
+
+// WithDebug enables the debug mode of the context.
+func WithDebug() Option {
+	return func(o *options) {
+		o.debug = true
+	}
+}
+
+// WithForceRequeueAfter sets the force requeue after of the context.
+func WithForceRequeueAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.forceRequeueAfter = d
+	}
+}
+
+// WithExec sets the stub handling the PodExec calls.
+func WithExec(stub *PodExecStub) Option {
+	return func(o *options) {
+		o.exec = stub
+	}
+}
+
+// WithPodLogs sets the logs of the container returned by PodLogs and StreamPodLogs.
+func WithPodLogs(namespace, pod, container, logs string) Option {
+	return func(o *options) {
+		o.logs[logsKey(namespace, pod, container)] = logs
+	}
+}
+
+// NewReconcileContext returns a fake reconcile context.
+func NewReconcileContext(opts ...Option) *FakeReconcileContext {
+	o := &options{owner: DefaultOwner, logs: map[string]string{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.scheme == nil {
+		o.scheme = runtime.NewScheme()
+		_ = clientgoscheme.AddToScheme(o.scheme)
+	}
+	if o.exec == nil {
+		o.exec = NewPodExecStub()
+	}
+	request := reconcile.Request{}
+	if o.request != nil {
+		request.NamespacedName = *o.request
+	} else if len(o.objects) > 0 {
+		request.NamespacedName = client.ObjectKeyFromObject(o.objects[0])
+	}
+
+	c := kube.NewRecordingClient(fake.NewClientBuilder().
+		WithScheme(o.scheme).
+		WithObjects(o.objects...).
+		Build(), false)
+	h := &helper{
+		DefaultReconcileHelper: kube.NewDefaultReconcileHelper(c, nil, nil, o.scheme),
+		exec:                   o.exec,
+		logs:                   o.logs,
+		debug:                  o.debug,
+	}
+	h.ResetForceRequeueAfter(o.forceRequeueAfter)
+	recorder := record.NewFakeRecorder(1024)
+
+	return &FakeReconcileContext{
+		BaseReconcileContext: kube.NewBaseReconcileContext(h, context.Background(), request, o.owner, recorder),
+		helper:               h,
+		client:               c,
+		events:               &eventLog{recorder: recorder},
+	}
+}
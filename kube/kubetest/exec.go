@@ -0,0 +1,122 @@
+package kubetest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/sqc157400661/helper/kube"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/exec"
+)
+
+// ExecCall is a PodExec call received by the stub.
+type ExecCall struct {
+	Namespace string
+	Pod       string
+	Container string
+	Command   []string
+}
+
+// ExecHandler handles a PodExec call. It should write the output to the Stdout and
+// Stderr of the options, if they are set.
+type ExecHandler func(call ExecCall, opts kube.ExecOptions) error
+
+type execRule struct {
+	prefix  []string
+	handler ExecHandler
+}
+
+func (r *execRule) matches(command []string) bool {
+	if len(command) < len(r.prefix) {
+		return false
+	}
+	for i, arg := range r.prefix {
+		if command[i] != arg {
+			return false
+		}
+	}
+	return true
+}
+
+// PodExecStub is a scriptable PodExec. Commands are matched by their prefixes, and
+// the last registered rule wins. Commands matching no rules fail.
+type PodExecStub struct {
+	mu    sync.Mutex
+	rules []execRule
+	calls []ExecCall
+}
+
+// Handle handles the commands starting with the prefix with the handler. An empty
+// prefix matches all the commands.
+func (s *PodExecStub) Handle(prefix []string, handler ExecHandler) *PodExecStub {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = append(s.rules, execRule{prefix: prefix, handler: handler})
+	return s
+}
+
+// Respond writes stdout and stderr and returns err for the commands starting with
+// the prefix.
+func (s *PodExecStub) Respond(prefix []string, stdout, stderr string, err error) *PodExecStub {
+	return s.Handle(prefix, func(call ExecCall, opts kube.ExecOptions) error {
+		if opts.Stdout != nil {
+			if _, err := io.WriteString(opts.Stdout, stdout); err != nil {
+				return err
+			}
+		}
+		if opts.Stderr != nil {
+			if _, err := io.WriteString(opts.Stderr, stderr); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+// ExitError returns the error of a command exiting with the code, which is reported
+// as the exit code by PodExecWithResult.
+func ExitError(code int) error {
+	return exec.CodeExitError{Err: fmt.Errorf("command terminated with exit code %d", code), Code: code}
+}
+
+// Calls returns the calls received so far.
+func (s *PodExecStub) Calls() []ExecCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]ExecCall(nil), s.calls...)
+}
+
+// PodExec records the call and handles it with the matched rule.
+func (s *PodExecStub) PodExec(pod *corev1.Pod, container string, command []string, opts kube.ExecOptions) error {
+	call := ExecCall{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   append([]string(nil), command...),
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	var handler ExecHandler
+	for i := len(s.rules) - 1; i >= 0; i-- {
+		if s.rules[i].matches(command) {
+			handler = s.rules[i].handler
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if handler == nil {
+		return fmt.Errorf("no exec stub for command %q in pod %s/%s", strings.Join(command, " "), pod.Namespace, pod.Name)
+	}
+	return handler(call, opts)
+}
+
+// NewPodExecStub returns a stub without any rules.
+func NewPodExecStub() *PodExecStub {
+	return &PodExecStub{}
+}
@@ -0,0 +1,94 @@
+package kubetest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sqc157400661/helper/kube"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestFakeReconcileContext(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+		Data:       map[string]string{"a": "1"},
+	}
+	rc := NewReconcileContext(WithObjects(cm))
+	rc.Exec().Respond([]string{"cat"}, "hello", "", nil)
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "s", Namespace: "default"}}
+	RunStep(t, rc, kube.NewStep("sync", func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+		live := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: rc.Name(), Namespace: rc.Namespace()}}
+		if err := rc.Get(live); err != nil {
+			return flow.Error(err, "Failed to get.")
+		}
+		desired := live.DeepCopy()
+		desired.Data["b"] = "2"
+		if err := rc.CSAApply(desired, live); err != nil {
+			return flow.Error(err, "Failed to apply.")
+		}
+		if err := rc.Client().Create(rc.Context(), secret.DeepCopy()); err != nil {
+			return flow.Error(err, "Failed to create.")
+		}
+
+		out := &bytes.Buffer{}
+		if err := rc.PodExec(&corev1.Pod{}, "main", []string{"cat", "/etc/hostname"}, kube.ExecOptions{Stdout: out}); err != nil {
+			return flow.Error(err, "Failed to exec.")
+		}
+		if out.String() != "hello" {
+			return flow.Error(errors.New(out.String()), "Unexpected output.")
+		}
+		rc.Recorder().Event(live, corev1.EventTypeNormal, "Synced", "Synced.")
+		return flow.Pass()
+	})).ExpectContinue()
+
+	rc.ExpectPatched(t, cm)
+	rc.ExpectCreated(t, secret)
+	assert.Equal(t, []string{"Normal Synced Synced."}, rc.Events())
+	assert.Equal(t, []ExecCall{{Pod: "", Container: "main", Command: []string{"cat", "/etc/hostname"}}}, rc.Exec().Calls())
+}
+
+func TestOutcomeExpectations(t *testing.T) {
+	rc := NewReconcileContext(WithRequest("default", "x"))
+	step := func(fn func(flow kube.Flow) (reconcile.Result, error)) kube.Step {
+		return kube.NewStep("test", func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+			return fn(flow)
+		})
+	}
+
+	RunStep(t, rc, step(func(flow kube.Flow) (reconcile.Result, error) {
+		return flow.Wait("Waiting.")
+	})).ExpectBreak()
+	RunStep(t, rc, step(func(flow kube.Flow) (reconcile.Result, error) {
+		return flow.RetryAfter(time.Minute, "Not ready.")
+	})).ExpectBreak().ExpectRequeueAfter(time.Minute)
+	RunStep(t, rc, step(func(flow kube.Flow) (reconcile.Result, error) {
+		return flow.Error(errors.New("boom"), "Failed.")
+	})).ExpectError()
+	RunStep(t, rc, step(func(flow kube.Flow) (reconcile.Result, error) {
+		return flow.RetryErr(errors.New("boom"), "Failed.")
+	})).ExpectError()
+	RunStep(t, rc, step(func(flow kube.Flow) (reconcile.Result, error) {
+		return flow.Continue("Done.")
+	})).ExpectContinue()
+
+	rc.ExpectNoWrites(t)
+	assert.Error(t, rc.PodExec(&corev1.Pod{}, "main", []string{"ls"}, kube.ExecOptions{}))
+}
+
+func TestPodLogs(t *testing.T) {
+	rc := NewReconcileContext(WithPodLogs("default", "db-0", "mysql", "a\nb\nc\n"))
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "default"}}
+
+	logs, err := rc.PodLogs(rc.Context(), pod, "mysql", kube.LogOptions{TailLines: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "b\nc\n", logs)
+
+	_, err = rc.PodLogs(rc.Context(), pod, "sidecar", kube.LogOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package kubetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/sqc157400661/helper/kube"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Outcome is the outcome of running a task with the fake reconcile context.
+type Outcome struct {
+	t testing.TB
+
+	// Result and Err are the ones returned by the executor.
+	Result reconcile.Result
+	Err    error
+	// Trace is the trace of the run.
+	Trace *kube.Trace
+}
+
+// errors returns the errors of the steps, including the ones reported by RetryErr.
+func (o *Outcome) errors() []error {
+	var errs []error
+	for _, s := range o.Trace.Spans {
+		if s.Kind != kube.SpanKindReconcile && s.Outcome == kube.OutcomeError {
+			errs = append(errs, s.Err)
+		}
+	}
+	return errs
+}
+
+func (o *Outcome) root() kube.Outcome {
+	if root := o.Trace.Root(); root != nil {
+		return root.Outcome
+	}
+	return ""
+}
+
+// ExpectContinue asserts that all the steps are executed without errors or breaks.
+func (o *Outcome) ExpectContinue() *Outcome {
+	o.t.Helper()
+	if o.Err != nil {
+		o.t.Errorf("expected the flow to continue, got error: %v", o.Err)
+	} else if errs := o.errors(); len(errs) > 0 {
+		o.t.Errorf("expected the flow to continue, got step errors: %v", errs)
+	} else if outcome := o.root(); outcome != kube.OutcomeComplete {
+		o.t.Errorf("expected the flow to continue, got %s", outcome)
+	}
+	return o
+}
+
+// ExpectBreak asserts that the flow is broken without errors, e.g. by Wait or Abort.
+func (o *Outcome) ExpectBreak() *Outcome {
+	o.t.Helper()
+	if o.Err != nil {
+		o.t.Errorf("expected the flow to break, got error: %v", o.Err)
+	} else if outcome := o.root(); outcome != kube.OutcomeBreak {
+		o.t.Errorf("expected the flow to break, got %s", outcome)
+	}
+	return o
+}
+
+// ExpectRequeueAfter asserts that the run is requeued after d without errors.
+func (o *Outcome) ExpectRequeueAfter(d time.Duration) *Outcome {
+	o.t.Helper()
+	if o.Err != nil {
+		o.t.Errorf("expected requeue after %s, got error: %v", d, o.Err)
+	} else if o.Result.RequeueAfter != d {
+		o.t.Errorf("expected requeue after %s, got %s", d, o.Result.RequeueAfter)
+	}
+	return o
+}
+
+// ExpectError asserts that the run returns an error, or any of the steps reports one,
+// e.g. by RetryErr.
+func (o *Outcome) ExpectError() *Outcome {
+	o.t.Helper()
+	if o.Err == nil && len(o.errors()) == 0 {
+		o.t.Errorf("expected an error, got %s", o.root())
+	}
+	return o
+}
+
+// testLogger returns a logger writing to the test log.
+func testLogger(t testing.TB) logr.Logger {
+	return funcr.New(func(prefix, args string) {
+		t.Helper()
+		t.Log(prefix, args)
+	}, funcr.Options{})
+}
+
+// RunTask executes the task with the reconcile context, and returns the outcome.
+func RunTask(t testing.TB, rc kube.ReconcileContext, task *kube.Task, opts ...kube.ExecutorOption) *Outcome {
+	t.Helper()
+
+	exporter := kube.NewInMemoryExporter()
+	opts = append([]kube.ExecutorOption{kube.WithTraceExporter(exporter)}, opts...)
+	result, err := kube.NewExecutor(testLogger(t), opts...).Execute(rc, task)
+
+	o := &Outcome{t: t, Result: result, Err: err, Trace: &kube.Trace{}}
+	if traces := exporter.Traces(); len(traces) > 0 {
+		o.Trace = traces[len(traces)-1]
+	}
+	return o
+}
+
+// Run binds the binders to a new task, executes it with the reconcile context, and
+// returns the outcome.
+func Run(t testing.TB, rc kube.ReconcileContext, binders ...kube.BindFunc) *Outcome {
+	t.Helper()
+
+	task := kube.NewTask()
+	for _, b := range binders {
+		b(task)
+	}
+	return RunTask(t, rc, task)
+}
+
+// RunStep executes the step with the reconcile context, and returns the outcome.
+func RunStep(t testing.TB, rc kube.ReconcileContext, step kube.Step) *Outcome {
+	t.Helper()
+	return Run(t, rc, kube.NewStepBinder(step))
+}
+
+// ExpectWritten asserts that the object is written with the verb, i.e. "create",
+// "update", "patch" or "delete". The status subresource is included.
+func (rc *FakeReconcileContext) ExpectWritten(t testing.TB, verb string, obj client.Object) {
+	t.Helper()
+
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if gvk, err := apiutil.GVKForObject(obj, rc.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	for _, w := range rc.Writes() {
+		if w.Verb == verb && w.Kind == kind && w.Namespace == obj.GetNamespace() && w.Name == obj.GetName() {
+			return
+		}
+	}
+	t.Errorf("expected %s %s %s/%s, got writes: %v", verb, kind, obj.GetNamespace(), obj.GetName(), rc.Writes())
+}
+
+// ExpectCreated asserts that the object is created.
+func (rc *FakeReconcileContext) ExpectCreated(t testing.TB, obj client.Object) {
+	t.Helper()
+	rc.ExpectWritten(t, "create", obj)
+}
+
+// ExpectPatched asserts that the object is patched.
+func (rc *FakeReconcileContext) ExpectPatched(t testing.TB, obj client.Object) {
+	t.Helper()
+	rc.ExpectWritten(t, "patch", obj)
+}
+
+// ExpectNoWrites asserts that nothing is written.
+func (rc *FakeReconcileContext) ExpectNoWrites(t testing.TB) {
+	t.Helper()
+	if writes := rc.Writes(); len(writes) > 0 {
+		t.Errorf("expected no writes, got: %v", writes)
+	}
+}
@@ -0,0 +1,267 @@
+package kube
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DefaultLeaseDuration is the duration of the leases held by Exclusive.
+const DefaultLeaseDuration = 30 * time.Second
+
+// LeaseHolderIdentity is the identity of this process in the holders of the leases. It
+// defaults to the hostname, i.e. the pod name, with a random suffix, and could be set
+// before any leases are acquired.
+var LeaseHolderIdentity = defaultLeaseHolderIdentity()
+
+// leaseHolder returns the holder identity of the leases acquired by the reconciles of
+// the request, so the concurrent reconciles of other requests never share the leases,
+// while the following reconciles of the request could renew them.
+func leaseHolder(rc ReconcileContext) string {
+	return LeaseHolderIdentity + "/" + rc.Request().String()
+}
+
+func defaultLeaseHolderIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+	return hostname + "_" + uuid.New().String()
+}
+
+// leaseIdleTimeout is the min duration the observation of a lease is kept since it's
+// last checked.
+const leaseIdleTimeout = 1 * time.Hour
+
+type observedLease struct {
+	resourceVersion string
+	observed        time.Time
+	checked         time.Time
+}
+
+// leaseObserver keeps the local time when the leases are seen changed in memory, like
+// the leader election of client-go, so the expiry of the leases held by others doesn't
+// depend on their clocks. The leases not checked for a while are evicted.
+type leaseObserver struct {
+	mu      sync.Mutex
+	entries map[string]*observedLease
+	swept   time.Time
+}
+
+// observe returns the local time when the lease is first seen with its resource version,
+// i.e. renewed or taken over.
+func (o *leaseObserver) observe(lease *coordinationv1.Lease, now time.Time) time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.sweep(now)
+	key := lease.Namespace + "/" + lease.Name
+	e, ok := o.entries[key]
+	if !ok || e.resourceVersion != lease.ResourceVersion {
+		e = &observedLease{resourceVersion: lease.ResourceVersion, observed: now}
+		o.entries[key] = e
+	}
+	e.checked = now
+	return e.observed
+}
+
+func (o *leaseObserver) sweep(now time.Time) {
+	if now.Sub(o.swept) < leaseIdleTimeout {
+		return
+	}
+	o.swept = now
+	for key, e := range o.entries {
+		if now.Sub(e.checked) > leaseIdleTimeout {
+			delete(o.entries, key)
+		}
+	}
+}
+
+var defaultLeaseObserver = &leaseObserver{entries: make(map[string]*observedLease), swept: time.Now()}
+
+// leaseExpired returns true if the lease is not held by anyone or not renewed in time. A
+// lease is renewed in time if it's changed within its duration since this process first
+// sees it, so a lease first seen is never expired until its duration passes.
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" ||
+		spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	observed := defaultLeaseObserver.observe(lease, now)
+	return observed.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
+
+// AcquireLease acquires or renews the coordination.k8s.io/v1 Lease in the namespace of
+// the context for ttl, and returns false if it's held by others. The lease is held by
+// LeaseHolderIdentity and the request of the context, i.e. the reconciles of other
+// requests are others, and could be taken over by others once it's not renewed in ttl.
+// The ttl of a lease held by others is counted from when this process sees it renewed
+// rather than from its renew time, so the clocks of others don't matter.
+func (rc *BaseReconcileContext) AcquireLease(name string, ttl time.Duration) (bool, error) {
+	now := metav1.NewMicroTime(time.Now())
+	holder := leaseHolder(rc)
+	seconds := int32(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: rc.Namespace()}}
+	if err := rc.Get(lease); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		lease.Spec = coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		}
+		err = rc.Client().Create(rc.context, lease, rc.owner)
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	held := lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == holder
+	if !held && !leaseExpired(lease, now.Time) {
+		return false, nil
+	}
+	if !held {
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions
+		}
+		transitions++
+		lease.Spec.HolderIdentity = &holder
+		lease.Spec.AcquireTime = &now
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+
+	// Updates are rejected on conflicts, so only one could take it over.
+	err := rc.Client().Update(rc.context, lease, rc.owner)
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReleaseLease releases the lease if it's held by the reconciles of the request, so others
+// could acquire it without waiting for it to expire.
+func (rc *BaseReconcileContext) ReleaseLease(name string) error {
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: rc.Namespace()}}
+	if err := rc.Get(lease); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != leaseHolder(rc) {
+		return nil
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.AcquireTime = nil
+	lease.Spec.RenewTime = nil
+	return client.IgnoreNotFound(rc.Client().Update(rc.context, lease, rc.owner))
+}
+
+type exclusive struct {
+	lease   string
+	ttl     time.Duration
+	binders []BindFunc
+}
+
+func (s *exclusive) Name() string {
+	return "Exclusive(" + s.lease + ")"
+}
+
+// renew renews the lease until stopped, and cancels the context once the lease is lost.
+func (s *exclusive) renew(rc ReconcileContext, flow Flow, cancel context.CancelFunc, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			held, err := rc.AcquireLease(s.lease, s.ttl)
+			if err != nil {
+				flow.Logger().Error(err, "Failed to renew lease.", "lease", s.lease)
+				continue
+			}
+			if !held {
+				flow.Logger().Info("Lease is lost, cancel the steps.", "lease", s.lease)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func (s *exclusive) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	held, err := rc.AcquireLease(s.lease, s.ttl)
+	if err != nil {
+		return flow.Error(err, "Failed to acquire lease.", "lease", s.lease)
+	}
+	if !held {
+		return flow.RetryAfter(s.ttl, "Lease is held by others.", "lease", s.lease)
+	}
+
+	parent := rc.Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	// The renewal must be stopped before the flow is used by following steps.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.renew(rc, forkFlow(flow, flow.Logger()), cancel, stop)
+	}()
+	result, err := executeBlock(withContext(rc, ctx), flow, ExtractStepsFromBindFunc(s.binders...), "exclusive")
+	close(stop)
+	wg.Wait()
+
+	// Keep the lease when the steps are to be continued in the next reconcile.
+	if inner, ok := flow.(innerFlow); ok && err == nil && inner.BreakLoop() {
+		return result, err
+	}
+	if err1 := rc.ReleaseLease(s.lease); err1 != nil {
+		flow.Logger().Error(err1, "Failed to release lease.", "lease", s.lease)
+	}
+	return result, err
+}
+
+// Exclusive executes the steps of the binders in order while holding the lease, so they
+// never run concurrently across the reconciles of other requests, replicas or shards of
+// controllers. It retries after DefaultLeaseDuration if the lease is held by others. The
+// lease is renewed while the steps run, and the context of the steps is cancelled if the
+// lease is lost. It's released after the steps unless they break the flow, in which case
+// it's kept to be renewed by the next reconcile of the request until it expires.
+func Exclusive(leaseName string, binders ...BindFunc) BindFunc {
+	return ExclusiveWithTTL(leaseName, DefaultLeaseDuration, binders...)
+}
+
+// ExclusiveWithTTL is Exclusive holding the lease for ttl, which is also the interval to
+// retry if the lease is held by others. The ttl defaults to DefaultLeaseDuration if it's
+// not positive, and is at least a second as the leases are held in seconds.
+func ExclusiveWithTTL(leaseName string, ttl time.Duration, binders ...BindFunc) BindFunc {
+	if ttl <= 0 {
+		ttl = DefaultLeaseDuration
+	} else if ttl < time.Second {
+		ttl = time.Second
+	}
+	return NewStepBinder(&exclusive{lease: leaseName, ttl: ttl, binders: binders})
+}
@@ -0,0 +1,82 @@
+package kube_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sqc157400661/helper/kube"
+	"github.com/sqc157400661/helper/kube/kubetest"
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestExclusive(t *testing.T) {
+	// The clock of others is ahead, which doesn't matter.
+	renewed := metav1.NewMicroTime(time.Now().Add(time.Hour))
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "db"), kubetest.WithObjects(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "failover", Namespace: "default"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       pointer.String("others"),
+			LeaseDurationSeconds: pointer.Int32(1),
+			RenewTime:            &renewed,
+		},
+	}))
+
+	executed := 0
+	failover := kube.Exclusive("failover", kube.NewStepBinder(kube.NewStep("failover", func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+		executed++
+		return flow.Pass()
+	})))
+
+	// Held by others.
+	kubetest.Run(t, rc, failover).ExpectRequeueAfter(kube.DefaultLeaseDuration)
+	assert.Equal(t, 0, executed)
+
+	// Taken over once not renewed in its duration since it's seen, and released after
+	// the steps.
+	time.Sleep(1100 * time.Millisecond)
+	kubetest.Run(t, rc, failover).ExpectContinue()
+	assert.Equal(t, 1, executed)
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: "failover", Namespace: "default"}}
+	assert.NoError(t, rc.Get(lease))
+	assert.Nil(t, lease.Spec.HolderIdentity)
+	assert.Equal(t, int32(1), *lease.Spec.LeaseTransitions)
+
+	// Acquired and renewed by the same holder.
+	held, err := rc.AcquireLease("migration", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, held)
+	held, err = rc.AcquireLease("migration", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, held)
+	assert.NoError(t, rc.ReleaseLease("migration"))
+}
+
+func TestLeaseHeldPerRequest(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "a"))
+	other := kube.NewBaseReconcileContext(rc, context.Background(),
+		reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "b"}}, kubetest.DefaultOwner, nil)
+
+	held, err := rc.AcquireLease("migration", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, held)
+
+	// The reconciles of other requests in the same process are others.
+	held, err = other.AcquireLease("migration", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, held)
+	assert.NoError(t, other.ReleaseLease("migration"))
+	held, err = rc.AcquireLease("migration", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, held)
+
+	// Retries after the ttl when held by others.
+	kubetest.Run(t, other, kube.ExclusiveWithTTL("migration", 10*time.Second)).ExpectRequeueAfter(10 * time.Second)
+	// Invalid ttls default to DefaultLeaseDuration.
+	kubetest.Run(t, other, kube.ExclusiveWithTTL("migration", 0)).ExpectRequeueAfter(kube.DefaultLeaseDuration)
+}
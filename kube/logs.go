@@ -0,0 +1,129 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultLogLimitBytes is the default limit of the logs returned by PodLogs.
+	DefaultLogLimitBytes = 64 << 10
+	// MaxLogLineBytes is the max length of the lines followed by StreamPodLogs.
+	MaxLogLineBytes = 1 << 20
+)
+
+var errNoClientSet = errors.New("client set is not set")
+
+// LogOptions are the options of PodLogs and StreamPodLogs.
+type LogOptions struct {
+	// TailLines is the number of lines from the end of the logs, zero means all.
+	TailLines int64
+	// SinceSeconds only returns the logs newer than it, zero means all.
+	SinceSeconds int64
+	// Previous returns the logs of the previous terminated container.
+	Previous bool
+	// Timestamps prefixes every line with its timestamp.
+	Timestamps bool
+	// LimitBytes limits the bytes of the logs returned by PodLogs, defaults to
+	// DefaultLogLimitBytes. Zero means no limit for StreamPodLogs.
+	LimitBytes int64
+}
+
+func (opts *LogOptions) podLogOptions(container string, follow bool) *corev1.PodLogOptions {
+	o := &corev1.PodLogOptions{
+		Container:  container,
+		Follow:     follow,
+		Previous:   opts.Previous,
+		Timestamps: opts.Timestamps,
+	}
+	if opts.TailLines > 0 {
+		o.TailLines = &opts.TailLines
+	}
+	if opts.SinceSeconds > 0 {
+		o.SinceSeconds = &opts.SinceSeconds
+	}
+	if opts.LimitBytes > 0 {
+		o.LimitBytes = &opts.LimitBytes
+	}
+	return o
+}
+
+// PodLogsWith returns the logs of the container with the client set, see PodLogs.
+func PodLogsWith(ctx context.Context, cs kubernetes.Interface, pod *corev1.Pod, container string, opts LogOptions) (string, error) {
+	if opts.LimitBytes <= 0 {
+		opts.LimitBytes = DefaultLogLimitBytes
+	}
+
+	stream, err := cs.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts.podLogOptions(container, false)).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	// The limit is also enforced here in case the server ignores it.
+	data, err := io.ReadAll(io.LimitReader(stream, opts.LimitBytes))
+	return string(data), err
+}
+
+// StreamPodLogsWith follows the logs of the container with the client set, see
+// StreamPodLogs.
+func StreamPodLogsWith(ctx context.Context, cs kubernetes.Interface, pod *corev1.Pod, container string, opts LogOptions, fn func(line string) error) error {
+	stream, err := cs.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts.podLogOptions(container, true)).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// Unblock the reading when the context is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.Close()
+		case <-done:
+		}
+	}()
+
+	err = scanLines(stream, fn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// scanLines calls fn with every line read from r, which is at most MaxLogLineBytes.
+func scanLines(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), MaxLogLineBytes)
+	for scanner.Scan() {
+		if err := fn(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// PodLogs returns the logs of the container in the pod, e.g. the tail of the logs to be
+// attached to an event when the pod is unhealthy.
+func (rc *DefaultReconcileHelper) PodLogs(ctx context.Context, pod *corev1.Pod, container string, opts LogOptions) (string, error) {
+	if rc.clientSet == nil {
+		return "", errNoClientSet
+	}
+	return PodLogsWith(ctx, rc.clientSet, pod, container, opts)
+}
+
+// StreamPodLogs follows the logs of the container in the pod, and delivers them line by
+// line to fn until the logs end, fn returns an error, or ctx is done. It fails with
+// bufio.ErrTooLong on the lines longer than MaxLogLineBytes.
+func (rc *DefaultReconcileHelper) StreamPodLogs(ctx context.Context, pod *corev1.Pod, container string, opts LogOptions, fn func(line string) error) error {
+	if rc.clientSet == nil {
+		return errNoClientSet
+	}
+	return StreamPodLogsWith(ctx, rc.clientSet, pod, container, opts, fn)
+}
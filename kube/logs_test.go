@@ -0,0 +1,60 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodLogs(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "default"}}
+
+	// The fake client set always returns "fake logs".
+	logs, err := PodLogsWith(context.Background(), cs, pod, "mysql", LogOptions{TailLines: 10, LimitBytes: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, "fake", logs)
+
+	lines := make([]string, 0)
+	err = StreamPodLogsWith(context.Background(), cs, pod, "mysql", LogOptions{}, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fake logs"}, lines)
+
+	assert.ErrorIs(t, (&DefaultReconcileHelper{}).StreamPodLogs(context.Background(), pod, "mysql", LogOptions{}, nil), errNoClientSet)
+}
+
+func TestScanLongLines(t *testing.T) {
+	long := strings.Repeat("x", 100<<10)
+	var lines []string
+	err := scanLines(strings.NewReader("short\n"+long+"\n"), func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"short", long}, lines)
+
+	err = scanLines(strings.NewReader(strings.Repeat("x", MaxLogLineBytes+1)), func(line string) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, bufio.ErrTooLong)
+}
+
+func TestLogOptions(t *testing.T) {
+	opts := LogOptions{TailLines: 20, Previous: true}
+	o := opts.podLogOptions("mysql", true)
+	assert.Equal(t, "mysql", o.Container)
+	assert.Equal(t, int64(20), *o.TailLines)
+	assert.True(t, o.Previous)
+	assert.True(t, o.Follow)
+	assert.Nil(t, o.SinceSeconds)
+	assert.Nil(t, o.LimitBytes)
+}
@@ -0,0 +1,148 @@
+package kube
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StepKind returns the kind of the step name, which drops the arguments of the built-in
+// steps, e.g. "Parallel" for "Parallel(a,b)", "StepIf" for "StepIf-cond-step" and
+// "RetryAfter" for "RetryAfter5s". Other names are returned as they are.
+func StepKind(name string) string {
+	if i := strings.IndexByte(name, '('); i > 0 {
+		return name[:i]
+	}
+	for _, prefix := range []string{"StepIfElse-", "StepIf-"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimSuffix(prefix, "-")
+		}
+	}
+	for _, prefix := range []string{"RetryAfter", "ScheduleAfter"} {
+		if strings.HasPrefix(name, prefix) {
+			if _, err := time.ParseDuration(name[len(prefix):]); err == nil {
+				return prefix
+			}
+		}
+	}
+	return name
+}
+
+// stepMetrics records the metrics of step execution.
+type stepMetrics struct {
+	executions       *prometheus.CounterVec
+	duration         *prometheus.HistogramVec
+	panics           *prometheus.CounterVec
+	deferredFailures *prometheus.CounterVec
+}
+
+func (m *stepMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.executions, m.duration, m.panics, m.deferredFailures}
+}
+
+func (m *stepMetrics) observe(step string, outcome Outcome, deferred bool, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.executions.WithLabelValues(step, string(outcome)).Inc()
+	m.duration.WithLabelValues(step).Observe(duration.Seconds())
+	if deferred && outcome == OutcomeError {
+		m.deferredFailures.WithLabelValues(step).Inc()
+	}
+}
+
+func (m *stepMetrics) observePanic(step string) {
+	if m == nil {
+		return
+	}
+	m.panics.WithLabelValues(step).Inc()
+}
+
+func newStepMetrics() *stepMetrics {
+	return &stepMetrics{
+		executions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kube_executor_step_executions_total",
+			Help: "Total number of step executions per step and outcome.",
+		}, []string{"step", "outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kube_executor_step_duration_seconds",
+			Help:    "Duration of step executions in seconds per step.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"step"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kube_executor_step_panics_total",
+			Help: "Total number of panics per step.",
+		}, []string{"step"}),
+		deferredFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kube_executor_deferred_step_failures_total",
+			Help: "Total number of failed deferred step executions per step.",
+		}, []string{"step"}),
+	}
+}
+
+var (
+	stepMetricsLock       sync.Mutex
+	stepMetricsRegistries = make(map[prometheus.Registerer]*stepMetrics)
+)
+
+// registerStepMetrics registers the step metrics to the registerer once, and returns
+// the registered ones.
+func registerStepMetrics(reg prometheus.Registerer) (*stepMetrics, error) {
+	stepMetricsLock.Lock()
+	defer stepMetricsLock.Unlock()
+
+	if m, ok := stepMetricsRegistries[reg]; ok {
+		return m, nil
+	}
+
+	m := newStepMetrics()
+	collectors := m.collectors()
+	for i, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			// Reuse the ones registered by others.
+			are := prometheus.AlreadyRegisteredError{}
+			if !errors.As(err, &are) {
+				return nil, err
+			}
+			collectors[i] = are.ExistingCollector
+		}
+	}
+	m.executions = collectors[0].(*prometheus.CounterVec)
+	m.duration = collectors[1].(*prometheus.HistogramVec)
+	m.panics = collectors[2].(*prometheus.CounterVec)
+	m.deferredFailures = collectors[3].(*prometheus.CounterVec)
+
+	stepMetricsRegistries[reg] = m
+	return m, nil
+}
+
+// WithMetrics records the metrics of steps to the registerer, e.g. the metrics.Registry
+// of controller-runtime. The step label is the StepKind of the step name by default,
+// so the label values are bounded, see WithMetricsStepName to override it. The metrics
+// are registered at the first time and shared by all the executors with the same
+// registerer:
+//   - kube_executor_step_executions_total{step, outcome}
+//   - kube_executor_step_duration_seconds{step}
+//   - kube_executor_step_panics_total{step}
+//   - kube_executor_deferred_step_failures_total{step}
+func WithMetrics(reg prometheus.Registerer) ExecutorOption {
+	return func(e *executor) {
+		m, err := registerStepMetrics(reg)
+		if err != nil {
+			e.logger.Error(err, "Failed to register step metrics.")
+			return
+		}
+		e.metrics = m
+	}
+}
+
+// WithMetricsStepName sets the function mapping the step names to the step label of the
+// metrics, which defaults to StepKind. It must return a bounded set of values.
+func WithMetricsStepName(fn func(name string) string) ExecutorOption {
+	return func(e *executor) {
+		e.metricsStepName = fn
+	}
+}
@@ -0,0 +1,61 @@
+package kube
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestWithMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	opts := []ExecutorOption{WithMetrics(reg)}
+	pass := NewStepBinder(NewStep("pass", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		return flow.Pass()
+	}))
+	for i := 0; i < 2; i++ {
+		_, _ = runTestTaskWithOptions(opts, pass, Wait("wait"))
+	}
+	_, _ = runTestTaskWithOptions(opts, NewStepBinder(NewStep("panic", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		panic("boom")
+	})))
+	_, _ = runTestTaskWithOptions(opts, RetryAfter(5*time.Second, "Retry."))
+
+	m, err := registerStepMetrics(reg)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.executions.WithLabelValues("pass", string(OutcomeContinue))))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.executions.WithLabelValues("Wait", string(OutcomeComplete))))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.panics.WithLabelValues("panic")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.executions.WithLabelValues("RetryAfter", string(OutcomeComplete))))
+	assert.Equal(t, 4, testutil.CollectAndCount(m.duration))
+}
+
+func TestStepKind(t *testing.T) {
+	for name, kind := range map[string]string{
+		"pass":                      "pass",
+		"Parallel(a,b)":             "Parallel",
+		"WaitForPodsReady(app=db)":  "WaitForPodsReady",
+		"StepIf-ready-sync":         "StepIf",
+		"StepIfElse-ready":          "StepIfElse",
+		"RetryAfter5s":              "RetryAfter",
+		"ScheduleAfter1m0s":         "ScheduleAfter",
+		"RetryAfterUpgrade":         "RetryAfterUpgrade",
+		"Exclusive(failover-lease)": "Exclusive",
+	} {
+		assert.Equal(t, kind, StepKind(name), name)
+	}
+}
+
+func TestWithMetricsStepName(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, _ = runTestTaskWithOptions([]ExecutorOption{WithMetrics(reg), WithMetricsStepName(func(name string) string {
+		return "all"
+	})}, RetryAfter(time.Second, "Retry."))
+
+	m, err := registerStepMetrics(reg)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.executions.WithLabelValues("all", string(OutcomeComplete))))
+}
@@ -0,0 +1,215 @@
+package kube
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// childOutcome is the outcome of a step executed on a forked flow.
+type childOutcome struct {
+	result   reconcile.Result
+	err      error
+	reported error
+	broken   bool
+	panicked interface{}
+}
+
+// runChild executes the step on the forked flow and recovers any panic, so that it can
+// be safely invoked in a separated goroutine.
+func runChild(rc ReconcileContext, f *flow, step Step) (o childOutcome) {
+	defer func() {
+		if r := recover(); r != nil {
+			o.panicked = r
+		}
+	}()
+
+	o.result, o.err = step.Execute(rc, f)
+	o.reported = f.stepErr()
+	o.broken = f.BreakLoop()
+	return
+}
+
+// outcome returns the outcome of the child step and the error reported, if any.
+func (o *childOutcome) outcome(f *flow) (Outcome, error) {
+	if o.panicked != nil {
+		return OutcomeError, panicToError(o.panicked)
+	}
+	return stepOutcome(f, o.err)
+}
+
+// failed returns true if the child step breaks the flow or fails.
+func (o *childOutcome) failed() bool {
+	return o.panicked != nil || o.err != nil || o.broken
+}
+
+// stepOutcome returns the outcome of a step executed on the flow with the error returned.
+func stepOutcome(f *flow, err error) (Outcome, error) {
+	if err == nil {
+		err = f.stepErr()
+	}
+	switch {
+	case err != nil:
+		return OutcomeError, err
+	case f.BreakLoop():
+		return OutcomeBreak, nil
+	default:
+		return OutcomeContinue, nil
+	}
+}
+
+// executeNested executes the step inside another one, in a child span of the flow and
+// with the step name attached to the logger.
+func executeNested(rc ReconcileContext, f Flow, step Step, key string) (reconcile.Result, error) {
+	inner, ok := f.(*flow)
+	if !ok {
+		return step.Execute(rc, f.WithLoggerValues(key, step.Name()))
+	}
+
+	c := inner.clone()
+	c.logger = inner.logger.WithValues(key, step.Name())
+	c.span = c.activeTracer().startSpan(inner.span, step.Name(), SpanKindStep)
+
+	result, err := step.Execute(rc, c)
+	outcome, spanErr := stepOutcome(c, err)
+	c.activeTracer().endSpan(c.span, outcome, spanErr)
+	return result, err
+}
+
+// executeBlock executes the steps inside another one in order until the flow breaks.
+func executeBlock(rc ReconcileContext, f Flow, steps []Step, key string) (result reconcile.Result, err error) {
+	for _, step := range steps {
+		result, err = executeNested(rc, f, step, key)
+		if err != nil {
+			return
+		}
+		if inner, ok := f.(innerFlow); ok && inner.BreakLoop() {
+			return
+		}
+	}
+	return
+}
+
+// block is a step executing the steps bound by the binders in order, which are bound
+// lazily when it's executed.
+type block struct {
+	name    string
+	binders []BindFunc
+}
+
+func (b *block) Name() string {
+	return b.name
+}
+
+func (b *block) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	return executeBlock(rc, flow, ExtractStepsFromBindFunc(b.binders...), "block")
+}
+
+// traceChild executes the step on the forked flow in a child span of the flow.
+func traceChild(rc ReconcileContext, f *flow, step Step) childOutcome {
+	span := f.activeTracer().startSpan(f.span, step.Name(), SpanKindStep)
+	f.span = span
+
+	o := runChild(rc, f, step)
+	outcome, err := o.outcome(f)
+	f.activeTracer().endSpan(span, outcome, err)
+	return o
+}
+
+// mergeResults merges two reconcile results. Any Requeue wins and the smallest
+// non-zero RequeueAfter wins.
+func mergeResults(a, b reconcile.Result) reconcile.Result {
+	if b.Requeue {
+		a.Requeue = true
+	}
+	if b.RequeueAfter > 0 && (a.RequeueAfter == 0 || b.RequeueAfter < a.RequeueAfter) {
+		a.RequeueAfter = b.RequeueAfter
+	}
+	return a
+}
+
+// mergeOutcomes merges the outcomes of child steps into the parent flow. Panics are
+// re-raised in the current goroutine so that they are handled by the executor.
+func mergeOutcomes(f Flow, outcomes []childOutcome, name string) (reconcile.Result, error) {
+	var result reconcile.Result
+	errs, reported := make([]error, 0), make([]error, 0)
+	broken := false
+	for _, o := range outcomes {
+		if o.panicked != nil {
+			panic(o.panicked)
+		}
+		result = mergeResults(result, o.result)
+		if o.err != nil {
+			errs = append(errs, o.err)
+		} else if o.reported != nil {
+			reported = append(reported, o.reported)
+		}
+		if o.broken {
+			broken = true
+		}
+	}
+
+	if len(errs) > 0 {
+		return f.Error(utilerrors.NewAggregate(errs), "Err detected in "+name+" steps.")
+	}
+	// Errors reported by RetryErr are kept in the flow.
+	if inner, ok := f.(*flow); ok && len(reported) > 0 {
+		inner.state.err = utilerrors.NewAggregate(reported)
+	}
+	if broken {
+		_, _ = f.Break("Break detected in "+name+" steps.",
+			"requeue", result.Requeue, "requeue-after", result.RequeueAfter)
+	}
+	return result, nil
+}
+
+type parallel struct {
+	steps []Step
+}
+
+func (p *parallel) Name() string {
+	names := make([]string, 0, len(p.steps))
+	for _, s := range p.steps {
+		names = append(names, s.Name())
+	}
+	return "Parallel(" + strings.Join(names, ",") + ")"
+}
+
+func (p *parallel) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	outcomes := make([]childOutcome, len(p.steps))
+
+	var wg sync.WaitGroup
+	for i, step := range p.steps {
+		log := flow.Logger().WithValues("parallel", step.Name(), "parallel-index", strconv.Itoa(i))
+		child := forkFlow(flow, log)
+
+		wg.Add(1)
+		go func(i int, step Step) {
+			defer wg.Done()
+			outcomes[i] = traceChild(rc, child, step)
+		}(i, step)
+	}
+	wg.Wait()
+
+	return mergeOutcomes(flow, outcomes, "parallel")
+}
+
+// NewParallelStep returns a step which executes the given steps concurrently against the
+// same reconcile context. The results are merged (any Requeue wins and the smallest
+// RequeueAfter wins), errors are aggregated, and the flow breaks if any of the steps
+// breaks it. Note the steps must be safe for concurrent use of the reconcile context.
+func NewParallelStep(steps ...Step) Step {
+	return &parallel{
+		steps: steps,
+	}
+}
+
+// Parallel binds the steps of the binders into a single step executing them concurrently.
+// See NewParallelStep for details.
+func Parallel(binders ...BindFunc) BindFunc {
+	return NewStepBinder(NewParallelStep(ExtractStepsFromBindFunc(binders...)...))
+}
@@ -0,0 +1,109 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type testReconcileContext struct {
+	ReconcileContext
+}
+
+func (rc *testReconcileContext) Context() context.Context {
+	return context.Background()
+}
+
+func (rc *testReconcileContext) Request() reconcile.Request {
+	return reconcile.Request{}
+}
+
+func (rc *testReconcileContext) Debug() bool {
+	return false
+}
+
+func (rc *testReconcileContext) ForceRequeueAfter() time.Duration {
+	return 0
+}
+
+func runTestTask(binders ...BindFunc) (reconcile.Result, error) {
+	return runTestTaskWithOptions(nil, binders...)
+}
+
+func runTestTaskWithOptions(opts []ExecutorOption, binders ...BindFunc) (reconcile.Result, error) {
+	task := NewTask()
+	for _, b := range binders {
+		b(task)
+	}
+	return NewExecutor(logr.Discard(), opts...).Execute(&testReconcileContext{}, task)
+}
+
+func TestParallelRunsConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(3)
+	barrier := func(name string) BindFunc {
+		return NewStepBinder(NewStep(name, func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			wg.Done()
+			wg.Wait()
+			return flow.Pass()
+		}))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := runTestTask(Parallel(barrier("a"), barrier("b"), barrier("c")))
+		assert.NoError(t, err)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("parallel steps are not executed concurrently")
+	}
+}
+
+func TestParallelMergesResults(t *testing.T) {
+	executed := false
+	result, err := runTestTask(
+		Parallel(
+			RetryAfter(3*time.Second, "a"),
+			RetryAfter(time.Second, "b"),
+			Retry("c"),
+		),
+		NewStepBinder(NewStep("after", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			executed = true
+			return flow.Pass()
+		})),
+	)
+	assert.NoError(t, err)
+	assert.True(t, result.Requeue)
+	assert.Equal(t, time.Second, result.RequeueAfter)
+	assert.False(t, executed, "flow should break after parallel steps")
+}
+
+func TestParallelCollectsErrors(t *testing.T) {
+	fail := func(name string) BindFunc {
+		return NewStepBinder(NewStep(name, func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			return flow.Error(errors.New(name+" failed"), "Failed.")
+		}))
+	}
+	_, err := runTestTask(Parallel(fail("a"), fail("b"), Wait("c")))
+	assert.ErrorContains(t, err, "a failed")
+	assert.ErrorContains(t, err, "b failed")
+}
+
+func TestParallelPanic(t *testing.T) {
+	_, err := runTestTask(Parallel(
+		NewStepBinder(NewStep("panic", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			panic("boom")
+		})),
+	))
+	assert.EqualError(t, err, "boom")
+}
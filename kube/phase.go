@@ -0,0 +1,273 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// PhaseCompleted is the phase of the machines whose last phase is finished.
+	PhaseCompleted = "Completed"
+	// PhaseFailed is the phase of the machines whose failure phase is finished.
+	PhaseFailed = "Failed"
+	// DefaultPhaseCheckInterval is the default interval to check the exit condition of
+	// the current phase again.
+	DefaultPhaseCheckInterval = 5 * time.Second
+)
+
+// ErrPhaseTimeout is returned when a phase times out and there's no failure phase.
+var ErrPhaseTimeout = errors.New("phase timed out")
+
+// PhaseAnnotation returns the annotation persisting the current phase of the machine.
+func PhaseAnnotation(machine string) string {
+	return "helper.kube.io/phase-" + machine
+}
+
+// PhaseEnteredAnnotation returns the annotation persisting the time when the current
+// phase of the machine is entered, in RFC 3339.
+func PhaseEnteredAnnotation(machine string) string {
+	return "helper.kube.io/phase-entered-" + machine
+}
+
+// CurrentPhase returns the current phase of the machine persisted in the object and the
+// time it's entered. The phase is empty if the machine hasn't started.
+func CurrentPhase(obj client.Object, machine string) (string, time.Time) {
+	annotations := obj.GetAnnotations()
+	entered, _ := time.Parse(time.RFC3339, annotations[PhaseEnteredAnnotation(machine)])
+	return annotations[PhaseAnnotation(machine)], entered
+}
+
+// Phase is a phase of a PhaseMachine.
+type Phase struct {
+	name        string
+	binders     []BindFunc
+	exit        Condition
+	timeout     time.Duration
+	interval    time.Duration
+	failOnError bool
+}
+
+// NewPhase returns a phase executing the steps of the binders in order. The phase exits
+// once all of them succeed, unless an exit condition is set.
+func NewPhase(name string, binders ...BindFunc) *Phase {
+	return &Phase{name: name, binders: binders, interval: DefaultPhaseCheckInterval}
+}
+
+// Name returns the name of the phase.
+func (p *Phase) Name() string {
+	return p.name
+}
+
+// ExitWhen sets the exit condition, which is evaluated after all the steps succeed. The
+// phase is checked again after the check interval if it's not satisfied.
+func (p *Phase) ExitWhen(cond Condition) *Phase {
+	p.exit = cond
+	return p
+}
+
+// Timeout sets the timeout of the phase since it's entered. Zero means no timeout.
+func (p *Phase) Timeout(timeout time.Duration) *Phase {
+	p.timeout = timeout
+	return p
+}
+
+// FailOnError makes the machine enter the failure phase once a step of the phase fails
+// with Flow.Error, instead of retrying the phase in the next reconcile. It's ignored by the failure phase
+// and the machines without one.
+func (p *Phase) FailOnError() *Phase {
+	p.failOnError = true
+	return p
+}
+
+// CheckInterval sets the interval to check the exit condition again, defaults to
+// DefaultPhaseCheckInterval.
+func (p *Phase) CheckInterval(interval time.Duration) *Phase {
+	p.interval = interval
+	return p
+}
+
+type phaseMachine struct {
+	obj     client.Object
+	name    string
+	phases  []*Phase
+	failure *Phase
+}
+
+func (s *phaseMachine) Name() string {
+	return "PhaseMachine(" + s.name + ")"
+}
+
+// find returns the phase and its index, which is -1 for the failure phase.
+func (s *phaseMachine) find(name string) (*Phase, int) {
+	for i, phase := range s.phases {
+		if phase.name == name {
+			return phase, i
+		}
+	}
+	if s.failure != nil && s.failure.name == name {
+		return s.failure, -1
+	}
+	return nil, 0
+}
+
+// next returns the phase after the given one.
+func (s *phaseMachine) next(index int) string {
+	switch {
+	case index < 0:
+		return PhaseFailed
+	case index+1 < len(s.phases):
+		return s.phases[index+1].name
+	default:
+		return PhaseCompleted
+	}
+}
+
+// enter persists the phase with the current time as its entry time.
+func (s *phaseMachine) enter(rc ReconcileContext, flow Flow, phase string) error {
+	err := patchMetadata(rc, s.obj, func() bool {
+		annotations := s.obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[PhaseAnnotation(s.name)] = phase
+		annotations[PhaseEnteredAnnotation(s.name)] = time.Now().UTC().Format(time.RFC3339)
+		s.obj.SetAnnotations(annotations)
+		return true
+	})
+	if err == nil {
+		flow.Logger().Info("Phase entered.", "machine", s.name, "phase", phase)
+	}
+	return err
+}
+
+// execute executes the steps of the phase, and returns true if it fails over to the
+// failure phase. The steps of such phases are executed on a forked flow, so their
+// errors never fail the flow.
+func (s *phaseMachine) execute(rc ReconcileContext, f Flow, phase *Phase, index int) (reconcile.Result, bool, error) {
+	steps := ExtractStepsFromBindFunc(phase.binders...)
+	if !phase.failOnError || index < 0 || s.failure == nil {
+		result, err := executeBlock(rc, f, steps, "phase")
+		return result, false, err
+	}
+
+	child := forkFlow(f, f.Logger())
+	result, err := executeBlock(rc, child, steps, "phase")
+	if err != nil {
+		return result, true, err
+	}
+	if inner, ok := f.(*flow); ok {
+		inner.merge(child)
+	}
+	return result, false, nil
+}
+
+func (s *phaseMachine) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	for {
+		current, entered := CurrentPhase(s.obj, s.name)
+		if current == PhaseCompleted || current == PhaseFailed {
+			return flow.Pass()
+		}
+		if current == "" || entered.IsZero() {
+			if current == "" {
+				current = s.phases[0].name
+			}
+			if err := s.enter(rc, flow, current); err != nil {
+				return flow.RetryErr(err, "Failed to enter phase.", "phase", current)
+			}
+			continue
+		}
+
+		phase, index := s.find(current)
+		if phase == nil {
+			return flow.Error(fmt.Errorf("unknown phase %q of machine %s", current, s.name), "Unknown phase.")
+		}
+
+		if phase.timeout > 0 && time.Since(entered) > phase.timeout {
+			if index < 0 || s.failure == nil {
+				return flow.Error(fmt.Errorf("%w: %s exceeded %s", ErrPhaseTimeout, current, phase.timeout),
+					"Phase timed out.", "phase", current)
+			}
+			flow.Logger().Info("Phase timed out.", "phase", current, "timeout", phase.timeout)
+			if err := s.enter(rc, flow, s.failure.name); err != nil {
+				return flow.RetryErr(err, "Failed to enter phase.", "phase", s.failure.name)
+			}
+			continue
+		}
+
+		result, failed, err := s.execute(rc, flow, phase, index)
+		if failed {
+			flow.Logger().Info("Phase failed.", "phase", current, "err", err.Error())
+			if err := s.enter(rc, flow, s.failure.name); err != nil {
+				return flow.RetryErr(err, "Failed to enter phase.", "phase", s.failure.name)
+			}
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if inner, ok := flow.(innerFlow); ok && inner.BreakLoop() {
+			return result, err
+		}
+
+		if phase.exit != nil {
+			done, err := evaluate(rc, flow, phase.exit)
+			if err != nil {
+				return flow.Error(err, "Evaluate exit condition failed.", "phase", current)
+			}
+			if !done {
+				return flow.RetryAfter(phase.interval, "Phase not finished.", "phase", current)
+			}
+		}
+
+		if err := s.enter(rc, flow, s.next(index)); err != nil {
+			return flow.RetryErr(err, "Failed to enter phase.", "phase", s.next(index))
+		}
+	}
+}
+
+// PhaseMachine drives the object through the phases in order across reconciles, e.g. for
+// a switchover or a rolling upgrade. The current phase and the time it's entered are
+// persisted in the annotations of the object, see PhaseAnnotation, and every reconcile
+// resumes at the stored phase. The phases finished in a reconcile are followed by the
+// next ones immediately, and the flow is requeued while a phase is not finished.
+//
+// A phase failing or breaking the flow is retried in the next reconcile. Once a phase
+// times out, the machine enters the failure phase, or fails with ErrPhaseTimeout if it's
+// nil. The failure phase is only entered on timeouts, and on the errors of the phases
+// set by Phase.FailOnError. The machine ends in PhaseCompleted after the last phase or
+// PhaseFailed after the failure phase, and passes from then on until the annotations
+// are removed. The object should be loaded by the previous steps. It returns an error if
+// there are no phases or the names of the phases aren't unique.
+func PhaseMachine(obj client.Object, name string, phases []*Phase, failure *Phase) (BindFunc, error) {
+	if len(phases) == 0 {
+		return nil, fmt.Errorf("phase machine %s has no phases", name)
+	}
+	names := make(map[string]bool, len(phases)+1)
+	all := phases
+	if failure != nil {
+		all = append(append([]*Phase(nil), phases...), failure)
+	}
+	for _, phase := range all {
+		if phase.name == PhaseCompleted || phase.name == PhaseFailed {
+			return nil, fmt.Errorf("phase machine %s has reserved phase %q", name, phase.name)
+		}
+		if names[phase.name] {
+			return nil, fmt.Errorf("phase machine %s has duplicated phase %q", name, phase.name)
+		}
+		names[phase.name] = true
+	}
+	return NewStepBinder(&phaseMachine{obj: obj, name: name, phases: phases, failure: failure}), nil
+}
+
+// MustPhaseMachine is like PhaseMachine but panics on errors.
+func MustPhaseMachine(obj client.Object, name string, phases []*Phase, failure *Phase) BindFunc {
+	b, err := PhaseMachine(obj, name, phases, failure)
+	if err != nil {
+		panic("invalid phase machine: " + err.Error())
+	}
+	return b
+}
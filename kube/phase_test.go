@@ -0,0 +1,150 @@
+package kube_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/sqc157400661/helper/kube"
+	"github.com/sqc157400661/helper/kube/kubetest"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func phaseTask(obj *corev1.ConfigMap, binders ...kube.BindFunc) []kube.BindFunc {
+	return append([]kube.BindFunc{
+		kube.NewStepBinder(kube.NewStep("load", func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+			obj.Name, obj.Namespace = rc.Name(), rc.Namespace()
+			if err := rc.Get(obj); err != nil {
+				return flow.Error(err, "Failed to load.")
+			}
+			return flow.Pass()
+		})),
+	}, binders...)
+}
+
+func recordStep(name string, executed *[]string) kube.BindFunc {
+	return kube.NewStepBinder(kube.NewStep(name, func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+		*executed = append(*executed, name)
+		return flow.Pass()
+	}))
+}
+
+func TestPhaseMachine(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+	}))
+
+	var executed []string
+	synced := false
+	machine := func(obj *corev1.ConfigMap) []kube.BindFunc {
+		return phaseTask(obj, kube.MustPhaseMachine(obj, "switchover", []*kube.Phase{
+			kube.NewPhase("prepare", recordStep("prepare", &executed)),
+			kube.NewPhase("switch", recordStep("switch", &executed)).
+				ExitWhen(kube.NewCondition("synced", func(rc kube.ReconcileContext, log logr.Logger) (bool, error) {
+					return synced, nil
+				})).
+				CheckInterval(time.Second),
+		}, nil), recordStep("after", &executed))
+	}
+
+	// The finished phases are followed by the next ones in the same reconcile.
+	obj := &corev1.ConfigMap{}
+	kubetest.Run(t, rc, machine(obj)...).ExpectRequeueAfter(time.Second)
+	assert.Equal(t, []string{"prepare", "switch"}, executed)
+	phase, entered := kube.CurrentPhase(obj, "switchover")
+	assert.Equal(t, "switch", phase)
+	assert.False(t, entered.IsZero())
+
+	// Resumed at the stored phase.
+	executed, synced = nil, true
+	obj = &corev1.ConfigMap{}
+	kubetest.Run(t, rc, machine(obj)...).ExpectContinue()
+	assert.Equal(t, []string{"switch", "after"}, executed)
+
+	live := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}}
+	assert.NoError(t, rc.Get(live))
+	phase, _ = kube.CurrentPhase(live, "switchover")
+	assert.Equal(t, kube.PhaseCompleted, phase)
+
+	// Completed machines pass.
+	executed = nil
+	kubetest.Run(t, rc, machine(&corev1.ConfigMap{})...).ExpectContinue()
+	assert.Equal(t, []string{"after"}, executed)
+}
+
+func TestPhaseMachineTimeout(t *testing.T) {
+	enteredAt := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default", Annotations: map[string]string{
+			kube.PhaseAnnotation("upgrade"):        "roll",
+			kube.PhaseEnteredAnnotation("upgrade"): enteredAt,
+		}},
+	}))
+
+	var executed []string
+	phases := []*kube.Phase{
+		kube.NewPhase("roll", recordStep("roll", &executed)).Timeout(time.Minute),
+	}
+
+	// Fails without the failure phase.
+	obj := &corev1.ConfigMap{}
+	err := kubetest.Run(t, rc, phaseTask(obj, kube.MustPhaseMachine(obj, "upgrade", phases, nil))...).ExpectError().Err
+	assert.ErrorIs(t, err, kube.ErrPhaseTimeout)
+	rc.ExpectNoWrites(t)
+
+	// Enters the failure phase.
+	obj = &corev1.ConfigMap{}
+	kubetest.Run(t, rc, phaseTask(obj, kube.MustPhaseMachine(obj, "upgrade", phases,
+		kube.NewPhase("rollback", recordStep("rollback", &executed))))...).ExpectContinue()
+	assert.Equal(t, []string{"rollback"}, executed)
+	phase, _ := kube.CurrentPhase(obj, "upgrade")
+	assert.Equal(t, kube.PhaseFailed, phase)
+}
+
+func TestPhaseMachineFailOnError(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+	}))
+
+	var executed []string
+	fail := kube.NewStepBinder(kube.NewStep("fail", func(rc kube.ReconcileContext, flow kube.Flow) (reconcile.Result, error) {
+		return flow.Error(errors.New("boom"), "Failed.")
+	}))
+	machine := func(obj *corev1.ConfigMap, roll *kube.Phase) []kube.BindFunc {
+		return phaseTask(obj, kube.MustPhaseMachine(obj, "upgrade", []*kube.Phase{roll},
+			kube.NewPhase("rollback", recordStep("rollback", &executed))))
+	}
+
+	// Failed phases are retried by default.
+	obj := &corev1.ConfigMap{}
+	kubetest.Run(t, rc, machine(obj, kube.NewPhase("roll", fail))...).ExpectError()
+	phase, _ := kube.CurrentPhase(obj, "upgrade")
+	assert.Equal(t, "roll", phase)
+	assert.Empty(t, executed)
+
+	// Or enter the failure phase, which continues the flow.
+	obj = &corev1.ConfigMap{}
+	outcome := kubetest.Run(t, rc, machine(obj, kube.NewPhase("roll", fail).FailOnError())...)
+	assert.NoError(t, outcome.Err)
+	assert.Equal(t, kube.OutcomeComplete, outcome.Trace.Root().Outcome)
+	assert.Equal(t, []string{"rollback"}, executed)
+	phase, _ = kube.CurrentPhase(obj, "upgrade")
+	assert.Equal(t, kube.PhaseFailed, phase)
+}
+
+func TestPhaseMachineInvalid(t *testing.T) {
+	obj := &corev1.ConfigMap{}
+	_, err := kube.PhaseMachine(obj, "upgrade", nil, nil)
+	assert.Error(t, err)
+	_, err = kube.PhaseMachine(obj, "upgrade", []*kube.Phase{kube.NewPhase("roll")}, kube.NewPhase("roll"))
+	assert.Error(t, err)
+	_, err = kube.PhaseMachine(obj, "upgrade", []*kube.Phase{kube.NewPhase(kube.PhaseCompleted)}, nil)
+	assert.Error(t, err)
+	assert.Panics(t, func() {
+		kube.MustPhaseMachine(obj, "upgrade", nil, nil)
+	})
+}
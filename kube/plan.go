@@ -0,0 +1,482 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// PlannedStep is a step visited in a run.
+type PlannedStep struct {
+	Name     string
+	Deferred bool
+	Outcome  Outcome
+	Err      error
+}
+
+// PlannedCondition is a condition evaluated in a run.
+type PlannedCondition struct {
+	Name   string
+	Result bool
+	Err    error
+}
+
+// PlannedWrite is a write to the API server recorded in a run.
+type PlannedWrite struct {
+	// Verb is one of create, update, patch, delete, deleteallof, apply and csa-apply.
+	Verb        string
+	Kind        string
+	Namespace   string
+	Name        string
+	Subresource string
+	// Diff is the JSON diff of the write. It's the patch itself for patches, and a JSON
+	// merge patch from the live object for the others.
+	Diff json.RawMessage
+}
+
+// PlannedExec is a command executed in a pod recorded in a run.
+type PlannedExec struct {
+	Namespace string
+	Pod       string
+	Container string
+	Command   []string
+}
+
+// Plan is the record of what a run does, or would do in dry-run mode.
+//
+// The commands executed in pods are not sent in dry-run mode, and succeed with empty
+// stdout and stderr by default, so the steps parsing the outputs may branch differently
+// from a real run. Set ExecHandler to stub the outputs.
+type Plan struct {
+	Steps      []PlannedStep
+	Conditions []PlannedCondition
+	Writes     []PlannedWrite
+	Execs      []PlannedExec
+
+	// ExecHandler handles the commands executed in pods in dry-run mode after they're
+	// recorded. It could write the outputs to opts.Stdout and opts.Stderr, and return an
+	// exec.CodeExitError for a non-zero exit code. It's called concurrently by the steps
+	// executed in parallel.
+	ExecHandler func(exec PlannedExec, opts ExecOptions) error
+}
+
+// String returns a human-readable summary of the plan.
+func (p *Plan) String() string {
+	var b strings.Builder
+	b.WriteString("Steps:\n")
+	for _, s := range p.Steps {
+		suffix := ""
+		if s.Deferred {
+			suffix = " [DEFER]"
+		}
+		fmt.Fprintf(&b, "  - %s%s: %s\n", s.Name, suffix, s.Outcome)
+	}
+	b.WriteString("Conditions:\n")
+	for _, c := range p.Conditions {
+		fmt.Fprintf(&b, "  - %s: %t\n", c.Name, c.Result)
+	}
+	b.WriteString("Writes:\n")
+	for _, w := range p.Writes {
+		target := w.Kind + " " + w.Namespace + "/" + w.Name
+		if w.Subresource != "" {
+			target += "/" + w.Subresource
+		}
+		fmt.Fprintf(&b, "  - %s %s: %s\n", w.Verb, target, string(w.Diff))
+	}
+	b.WriteString("Execs:\n")
+	for _, e := range p.Execs {
+		fmt.Fprintf(&b, "  - %s/%s[%s]: %s\n", e.Namespace, e.Pod, e.Container, strings.Join(e.Command, " "))
+	}
+	return b.String()
+}
+
+// fill fills the steps and conditions from the trace.
+func (p *Plan) fill(trace *Trace) {
+	for _, s := range trace.Spans {
+		switch s.Kind {
+		case SpanKindStep, SpanKindDeferredStep:
+			p.Steps = append(p.Steps, PlannedStep{
+				Name:     s.Name,
+				Deferred: s.Kind == SpanKindDeferredStep,
+				Outcome:  s.Outcome,
+				Err:      s.Err,
+			})
+		case SpanKindCondition:
+			result, _ := s.Attributes["result"].(bool)
+			p.Conditions = append(p.Conditions, PlannedCondition{
+				Name:   s.Name,
+				Result: result,
+				Err:    s.Err,
+			})
+		}
+	}
+}
+
+// RecordingClient is a client recording all the writes. Reads are always sent to
+// the underlying client, while writes are only sent when it's not in dry-run mode. The
+// commands executed in pods are not writes of the client, see Plan for how they're
+// handled in dry-run mode.
+type RecordingClient struct {
+	client.Client
+	dryRun bool
+
+	mu     sync.Mutex
+	writes []PlannedWrite
+}
+
+// Writes returns the recorded writes.
+func (c *RecordingClient) Writes() []PlannedWrite {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]PlannedWrite(nil), c.writes...)
+}
+
+func (c *RecordingClient) record(verb string, obj client.Object, subresource string, diff []byte) {
+	kind := ""
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes = append(c.writes, PlannedWrite{
+		Verb:        verb,
+		Kind:        kind,
+		Namespace:   obj.GetNamespace(),
+		Name:        obj.GetName(),
+		Subresource: subresource,
+		Diff:        diff,
+	})
+}
+
+// recordDiff records the write with a diff from the live object.
+func (c *RecordingClient) recordDiff(ctx context.Context, verb string, obj client.Object, subresource string) error {
+	diff, exists, err := diffFromLive(ctx, c.Client, obj, subresource)
+	if err != nil {
+		return err
+	}
+	if !exists && verb != "create" {
+		verb = "create"
+	}
+	c.record(verb, obj, subresource, diff)
+	return nil
+}
+
+func (c *RecordingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	data, err := desiredJSON(obj, "")
+	if err != nil {
+		return err
+	}
+	c.record("create", obj, "", data)
+	if c.dryRun {
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *RecordingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.recordDiff(ctx, "update", obj, ""); err != nil {
+		return err
+	}
+	if c.dryRun {
+		return nil
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *RecordingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	c.record("patch", obj, "", data)
+	if c.dryRun {
+		return nil
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *RecordingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.record("delete", obj, "", nil)
+	if c.dryRun {
+		return nil
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *RecordingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	c.record("deleteallof", obj, "", nil)
+	if c.dryRun {
+		return nil
+	}
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c *RecordingClient) Status() client.StatusWriter {
+	return &recordingStatusWriter{
+		StatusWriter: c.Client.Status(),
+		client:       c,
+	}
+}
+
+type recordingStatusWriter struct {
+	client.StatusWriter
+	client *RecordingClient
+}
+
+func (w *recordingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	if err := w.client.recordDiff(ctx, "update", obj, "status"); err != nil {
+		return err
+	}
+	if w.client.dryRun {
+		return nil
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func (w *recordingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	w.client.record("patch", obj, "status", data)
+	if w.client.dryRun {
+		return nil
+	}
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+// NewRecordingClient returns a client recording the writes sent by c. In dry-run
+// mode, the writes are never sent.
+func NewRecordingClient(c client.Client, dryRun bool) *RecordingClient {
+	return &RecordingClient{
+		Client: c,
+		dryRun: dryRun,
+	}
+}
+
+// desiredJSON returns the JSON of the object without null values, which are zero values
+// of the typed objects. Only status is kept for the status subresource, otherwise
+// status is dropped.
+func desiredJSON(obj client.Object, subresource string) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if subresource == "status" {
+		m = map[string]interface{}{"status": m["status"]}
+	} else {
+		delete(m, "status")
+	}
+	if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "managedFields")
+		delete(metadata, "resourceVersion")
+	}
+	pruneNulls(m)
+	return json.Marshal(m)
+}
+
+func pruneNulls(m map[string]interface{}) {
+	for k, v := range m {
+		switch v := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]interface{}:
+			pruneNulls(v)
+		case []interface{}:
+			for _, e := range v {
+				if e, ok := e.(map[string]interface{}); ok {
+					pruneNulls(e)
+				}
+			}
+		}
+	}
+}
+
+// diffFromLive returns a JSON merge patch from the live object to the live object
+// with the desired one applied, which contains only the fields to be changed. It also
+// returns whether the live object exists.
+func diffFromLive(ctx context.Context, c client.Reader, obj client.Object, subresource string) ([]byte, bool, error) {
+	desired, err := desiredJSON(obj, subresource)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Type meta of typed objects are usually not set by the client.
+	var m map[string]interface{}
+	if err := json.Unmarshal(desired, &m); err != nil {
+		return nil, false, err
+	}
+	delete(m, "apiVersion")
+	delete(m, "kind")
+	if desired, err = json.Marshal(m); err != nil {
+		return nil, false, err
+	}
+
+	live := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(client.Object)
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		live.(*unstructured.Unstructured).SetGroupVersionKind(u.GroupVersionKind())
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		if apierrors.IsNotFound(err) {
+			return desired, false, nil
+		}
+		return nil, false, err
+	}
+
+	liveData, err := json.Marshal(live)
+	if err != nil {
+		return nil, true, err
+	}
+	merged, err := jsonpatch.MergePatch(liveData, desired)
+	if err != nil {
+		return nil, true, err
+	}
+	diff, err := jsonpatch.CreateMergePatch(liveData, merged)
+	return diff, true, err
+}
+
+// dryRunContext is a reconcile context recording all the writes and pod executions
+// without sending them.
+type dryRunContext struct {
+	ReconcileContext
+	client *RecordingClient
+	plan   *Plan
+	mu     *sync.Mutex
+}
+
+func (rc *dryRunContext) Client() client.Client {
+	return rc.client
+}
+
+func (rc *dryRunContext) Patch(object client.Object, patch client.Patch, options ...client.PatchOption) error {
+	return rc.client.Patch(rc.Context(), object, patch, options...)
+}
+
+func (rc *dryRunContext) Apply(object client.Object) error {
+	return rc.client.recordDiff(rc.Context(), "apply", object, "")
+}
+
+func (rc *dryRunContext) CSAApply(object client.Object, old ...client.Object) error {
+	return rc.client.recordDiff(rc.Context(), "csa-apply", object, "")
+}
+
+func (rc *dryRunContext) PatchStatus(object client.Object, mutate func()) error {
+	if _, changed := mutateStatus(object, mutate); !changed {
+		return nil
+	}
+	return rc.client.recordDiff(rc.Context(), "patch", object, "status")
+}
+
+func (rc *dryRunContext) ApplyStatus(object client.Object) error {
+	setObservedGeneration(object)
+	return rc.client.recordDiff(rc.Context(), "apply", object, "status")
+}
+
+// PodExec records the command, and executes it with Plan.ExecHandler if set.
+func (rc *dryRunContext) PodExec(pod *corev1.Pod, container string, command []string, opts ExecOptions) error {
+	exec := PlannedExec{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   command,
+	}
+	rc.mu.Lock()
+	rc.plan.Execs = append(rc.plan.Execs, exec)
+	rc.mu.Unlock()
+
+	if rc.plan.ExecHandler == nil {
+		return nil
+	}
+	return rc.plan.ExecHandler(exec, opts)
+}
+
+func (rc *dryRunContext) PodExecWithResult(ctx context.Context, pod *corev1.Pod, container string, command []string, opts ExecOptions) (*ExecResult, error) {
+	return ExecWithResult(ctx, opts, func(ctx context.Context, opts ExecOptions) error {
+		return rc.PodExec(pod, container, command, opts)
+	})
+}
+
+func (rc *dryRunContext) CopyToPod(ctx context.Context, pod *corev1.Pod, container string, src, dst string, opts CopyOptions) error {
+	return CopyToPodWith(ctx, func(command []string, opts ExecOptions) error {
+		if err := rc.PodExec(pod, container, command, opts); err != nil {
+			return err
+		}
+		_, err := io.Copy(io.Discard, opts.Stdin)
+		return err
+	}, src, dst, opts)
+}
+
+func (rc *dryRunContext) CopyFromPod(ctx context.Context, pod *corev1.Pod, container string, src, dst string, opts CopyOptions) error {
+	return CopyFromPodWith(ctx, func(command []string, opts ExecOptions) error {
+		return rc.PodExec(pod, container, command, opts)
+	}, src, dst, opts)
+}
+
+// AcquireLease always acquires the lease without writing it.
+func (rc *dryRunContext) AcquireLease(name string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (rc *dryRunContext) ReleaseLease(name string) error {
+	return nil
+}
+
+// Recorder returns a recorder dropping all the events.
+func (rc *dryRunContext) Recorder() record.EventRecorder {
+	return &record.FakeRecorder{}
+}
+
+func (rc *dryRunContext) WithContext(ctx context.Context) ReconcileContext {
+	c := *rc
+	c.ReconcileContext = withContext(rc.ReconcileContext, ctx)
+	return &c
+}
+
+func newDryRunContext(rc ReconcileContext, plan *Plan) *dryRunContext {
+	return &dryRunContext{
+		ReconcileContext: rc,
+		client:           NewRecordingClient(rc.Client(), true),
+		plan:             plan,
+		mu:               &sync.Mutex{},
+	}
+}
+
+// finishPlan fills the plan with the trace and writes recorded.
+func (e *executor) finishPlan(rc ReconcileContext, trace *Trace) {
+	e.plan.fill(trace)
+	if drc, ok := rc.(*dryRunContext); ok {
+		e.plan.Writes = append(e.plan.Writes, drc.client.Writes()...)
+	}
+}
+
+// DryRun runs the task in dry-run mode and records what it would do into the plan. The
+// client of the reconcile context is replaced by a recording one, which never sends
+// writes. Apply, CSAApply, Patch, PatchStatus, ApplyStatus and PodExec are recorded but
+// not sent as well, and the commands succeed with empty outputs unless
+// Plan.ExecHandler is set. Note reads are still sent to the API server, and steps
+// asserting the concrete type of the reconcile context will fail.
+func DryRun(plan *Plan) ExecutorOption {
+	return func(e *executor) {
+		e.plan = plan
+	}
+}
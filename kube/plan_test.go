@@ -0,0 +1,95 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestDryRun(t *testing.T) {
+	live := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+		Data:       map[string]string{"a": "1", "b": "2"},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live).Build()
+	h := NewDefaultReconcileHelper(c, nil, nil, scheme.Scheme)
+	rc := NewBaseReconcileContext(h, context.Background(),
+		reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "cm"}}, "test", nil)
+
+	task := NewTask()
+	NewStepBinder(NewStep("write", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+			Data:       map[string]string{"a": "1", "b": "3"},
+		}
+		if err := rc.CSAApply(cm); err != nil {
+			return flow.Error(err, "Failed to apply.")
+		}
+		created := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "s", Namespace: "default"}}
+		if err := rc.Client().Create(rc.Context(), created); err != nil {
+			return flow.Error(err, "Failed to create.")
+		}
+		if err := rc.Patch(cm, client.RawPatch(types.MergePatchType, []byte(`{"data":{"c":"4"}}`))); err != nil {
+			return flow.Error(err, "Failed to patch.")
+		}
+		if err := rc.PodExec(&corev1.Pod{}, "mysql", []string{"mysql", "-e", "SELECT 1"}, ExecOptions{}); err != nil {
+			return flow.Error(err, "Failed to exec.")
+		}
+		return flow.Pass()
+	}))(task)
+
+	plan := &Plan{}
+	_, err := NewExecutor(logr.Discard(), DryRun(plan)).Execute(rc, task)
+	assert.NoError(t, err)
+
+	assert.Len(t, plan.Steps, 1)
+	assert.Len(t, plan.Writes, 3)
+	assert.Equal(t, "csa-apply", plan.Writes[0].Verb)
+	assert.Equal(t, "ConfigMap", plan.Writes[0].Kind)
+	assert.JSONEq(t, `{"data":{"b":"3"}}`, string(plan.Writes[0].Diff))
+	assert.Equal(t, "create", plan.Writes[1].Verb)
+	assert.Equal(t, "patch", plan.Writes[2].Verb)
+	assert.Len(t, plan.Execs, 1)
+
+	// Nothing is changed.
+	actual := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(live), actual))
+	assert.Equal(t, live.Data, actual.Data)
+	assert.Error(t, c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "s"}, &corev1.Secret{}))
+}
+
+func TestDryRunExecHandler(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	h := NewDefaultReconcileHelper(c, nil, nil, scheme.Scheme)
+	rc := NewBaseReconcileContext(h, context.Background(), reconcile.Request{}, "test", nil)
+
+	var stdout string
+	task := NewTask()
+	NewStepBinder(NewStep("exec", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		result, err := rc.PodExecWithResult(rc.Context(), &corev1.Pod{}, "mysql", []string{"mysql", "-e", "SELECT 1"}, ExecOptions{})
+		if err != nil {
+			return flow.Error(err, "Failed to exec.")
+		}
+		stdout = result.Stdout
+		return flow.Pass()
+	}))(task)
+
+	plan := &Plan{ExecHandler: func(exec PlannedExec, opts ExecOptions) error {
+		_, err := io.WriteString(opts.Stdout, "1")
+		return err
+	}}
+	_, err := NewExecutor(logr.Discard(), DryRun(plan)).Execute(rc, task)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", stdout)
+	assert.Len(t, plan.Execs, 1)
+}
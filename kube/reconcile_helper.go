@@ -2,6 +2,7 @@ package kube
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"github.com/sqc157400661/util"
 	"io"
@@ -25,6 +26,13 @@ type ExecOptions struct {
 	Stdout  io.Writer
 	Stderr  io.Writer
 	Timeout time.Duration
+
+	// MaxOutputBytes caps the stdout and stderr captured by PodExecWithResult each,
+	// defaults to DefaultMaxOutputBytes.
+	MaxOutputBytes int
+	// Retry retries PodExecWithResult on transient stream errors when there's no stdin.
+	// Only the backoff and MaxAttempts are used.
+	Retry *RetryPolicy
 }
 
 func (opts *ExecOptions) setDefaults() {
@@ -41,6 +49,7 @@ func (opts *ExecOptions) setDefaults() {
 
 type ReconcilePodExecCommandHelper interface {
 	PodExec(pod *corev1.Pod, container string, command []string, opts ExecOptions) error
+	PodExecWithResult(ctx context.Context, pod *corev1.Pod, container string, command []string, opts ExecOptions) (*ExecResult, error)
 }
 
 // ReconcileHelper declares the reconcile helper.
@@ -60,6 +69,16 @@ type ReconcileHelper interface {
 	ClientSet() *kubernetes.Clientset
 	// Scheme returns the currently using scheme.
 	Scheme() *runtime.Scheme
+
+	// CopyToPod copies the local file or directory into the directory in the container.
+	CopyToPod(ctx context.Context, pod *corev1.Pod, container string, src, dst string, opts CopyOptions) error
+	// CopyFromPod copies the file or directory in the container into the local directory.
+	CopyFromPod(ctx context.Context, pod *corev1.Pod, container string, src, dst string, opts CopyOptions) error
+
+	// PodLogs returns the logs of the container.
+	PodLogs(ctx context.Context, pod *corev1.Pod, container string, opts LogOptions) (string, error)
+	// StreamPodLogs follows the logs of the container line by line.
+	StreamPodLogs(ctx context.Context, pod *corev1.Pod, container string, opts LogOptions, fn func(line string) error) error
 }
 
 type DefaultReconcileHelper struct {
@@ -76,6 +95,11 @@ func (rc *DefaultReconcileHelper) Debug() bool {
 }
 
 func (rc *DefaultReconcileHelper) PodExec(pod *corev1.Pod, container string, command []string, opts ExecOptions) error {
+	return rc.podExec(context.Background(), pod, container, command, opts)
+}
+
+// podExec executes the command like PodExec, and closes the stream once ctx is done.
+func (rc *DefaultReconcileHelper) podExec(ctx context.Context, pod *corev1.Pod, container string, command []string, opts ExecOptions) error {
 	if util.GetContainerFromPod(pod, container) == nil {
 		return errors.New("container " + container + " not found in pod " + pod.Name)
 	}
@@ -111,7 +135,7 @@ func (rc *DefaultReconcileHelper) PodExec(pod *corev1.Pod, container string, com
 	if err != nil {
 		return err
 	}
-	err = exec.Stream(remotecommand.StreamOptions{
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
 		Stdin:  opts.Stdin,
 		Stdout: opts.Stdout,
 		Stderr: opts.Stderr,
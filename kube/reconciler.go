@@ -0,0 +1,176 @@
+package kube
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DebugAnnotation enables the debug mode of the reconciles of the object, see
+// ReconcileHelper.Debug, when it's set to "true".
+const DebugAnnotation = "helper.kube.io/debug"
+
+type reconcilerOptions struct {
+	name          string
+	owner         client.FieldOwner
+	logger        *logr.Logger
+	executorOpts  []ExecutorOption
+	executorOptFn func(obj client.Object) []ExecutorOption
+}
+
+// ReconcilerOption is an option of NewReconciler.
+type ReconcilerOption func(o *reconcilerOptions)
+
+// WithReconcilerName sets the name of the reconciler, which is the name of the event
+// recorder and the default field owner. It defaults to the lowercase kind of the object
+// with a "-controller" suffix.
+func WithReconcilerName(name string) ReconcilerOption {
+	return func(o *reconcilerOptions) {
+		o.name = name
+	}
+}
+
+// WithFieldOwner sets the field owner of the writes, defaults to the reconciler name.
+func WithFieldOwner(owner client.FieldOwner) ReconcilerOption {
+	return func(o *reconcilerOptions) {
+		o.owner = owner
+	}
+}
+
+// WithReconcilerLogger sets the logger, defaults to the logger of the manager named after
+// the reconciler.
+func WithReconcilerLogger(logger logr.Logger) ReconcilerOption {
+	return func(o *reconcilerOptions) {
+		o.logger = &logger
+	}
+}
+
+// WithExecutorOptions sets the options of the executors. The options depending on the
+// object, e.g. WithEvents, should be set with WithObjectExecutorOptions.
+func WithExecutorOptions(opts ...ExecutorOption) ReconcilerOption {
+	return func(o *reconcilerOptions) {
+		o.executorOpts = append(o.executorOpts, opts...)
+	}
+}
+
+// WithObjectExecutorOptions sets the options of the executors built from the object
+// fetched in each reconcile, e.g. WithEvents and WithStatusConditions.
+func WithObjectExecutorOptions(fn func(obj client.Object) []ExecutorOption) ReconcilerOption {
+	return func(o *reconcilerOptions) {
+		o.executorOptFn = fn
+	}
+}
+
+// debugReconcileHelper enables the debug mode of the helper.
+type debugReconcileHelper struct {
+	ReconcileHelper
+}
+
+func (h *debugReconcileHelper) Debug() bool {
+	return true
+}
+
+// Reconciler is a reconcile.Reconciler executing the task built for the object of each
+// request, see NewReconciler.
+type Reconciler[T client.Object] struct {
+	helper    *DefaultReconcileHelper
+	recorder  record.EventRecorder
+	logger    logr.Logger
+	owner     client.FieldOwner
+	newObj    func() T
+	buildTask func(rc ReconcileContext, obj T) []BindFunc
+	opts      reconcilerOptions
+}
+
+func newReconciler[T client.Object](helper *DefaultReconcileHelper, recorderFor func(name string) record.EventRecorder,
+	logger logr.Logger, newObj func() T, buildTask func(rc ReconcileContext, obj T) []BindFunc, opts []ReconcilerOption) (*Reconciler[T], error) {
+	o := reconcilerOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.name == "" {
+		gvk, err := apiutil.GVKForObject(newObj(), helper.Scheme())
+		if err != nil {
+			return nil, err
+		}
+		o.name = strings.ToLower(gvk.Kind) + "-controller"
+	}
+	if o.owner == "" {
+		o.owner = client.FieldOwner(o.name)
+	}
+	if o.logger != nil {
+		logger = *o.logger
+	} else {
+		logger = logger.WithName(o.name)
+	}
+
+	return &Reconciler[T]{
+		helper:    helper,
+		recorder:  recorderFor(o.name),
+		logger:    logger,
+		owner:     o.owner,
+		newObj:    newObj,
+		buildTask: buildTask,
+		opts:      o,
+	}, nil
+}
+
+// NewReconciler returns a reconciler wiring the manager, the reconcile context and the
+// executor. For each request, it fetches the object returned by newObj, builds the task
+// with buildTask, and executes it with a BaseReconcileContext writing with the field
+// owner and emitting events with the recorder named after the reconciler. Requests of
+// the objects not found are ignored, and the objects with DebugAnnotation are reconciled
+// in the debug mode.
+func NewReconciler[T client.Object](mgr manager.Manager, newObj func() T, buildTask func(rc ReconcileContext, obj T) []BindFunc, opts ...ReconcilerOption) (*Reconciler[T], error) {
+	helper, err := NewDefaultReconcileHelperWithManager(mgr)
+	if err != nil {
+		return nil, err
+	}
+	return newReconciler(helper, mgr.GetEventRecorderFor, mgr.GetLogger(), newObj, buildTask, opts)
+}
+
+func (r *Reconciler[T]) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	log := r.logger.WithValues("request", request.String())
+
+	obj := r.newObj()
+	obj.SetName(request.Name)
+	obj.SetNamespace(request.Namespace)
+	if err := r.helper.Client().Get(ctx, request.NamespacedName, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.V(1).Info("Object not found, ignore.")
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// The helper keeps the force requeue after of the request.
+	helper := *r.helper
+	var h ReconcileHelper = &helper
+	if obj.GetAnnotations()[DebugAnnotation] == "true" {
+		h = &debugReconcileHelper{ReconcileHelper: h}
+	}
+	rc := NewBaseReconcileContext(h, ctx, request, r.owner, r.recorder)
+	defer func() {
+		if err1 := rc.Close(); err1 != nil {
+			log.Error(err1, "Failed to close reconcile context.")
+		}
+	}()
+
+	opts := append([]ExecutorOption(nil), r.opts.executorOpts...)
+	if r.opts.executorOptFn != nil {
+		opts = append(opts, r.opts.executorOptFn(obj)...)
+	}
+
+	task := NewTask()
+	for _, b := range r.buildTask(rc, obj) {
+		b(task)
+	}
+	return NewExecutor(log, opts...).Execute(rc, task)
+}
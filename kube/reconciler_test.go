@@ -0,0 +1,84 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ reconcile.Reconciler = &Reconciler[*corev1.ConfigMap]{}
+
+func TestReconciler(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name: "debug", Namespace: "default", Annotations: map[string]string{DebugAnnotation: "true"},
+		}},
+	).Build()
+
+	var recorderName string
+	recorder := record.NewFakeRecorder(16)
+	type call struct {
+		name  string
+		owner string
+		debug bool
+	}
+	var calls []call
+
+	r, err := newReconciler(NewDefaultReconcileHelper(c, nil, nil, scheme.Scheme),
+		func(name string) record.EventRecorder {
+			recorderName = name
+			return recorder
+		}, logr.Discard(),
+		func() *corev1.ConfigMap { return &corev1.ConfigMap{} },
+		func(rc ReconcileContext, obj *corev1.ConfigMap) []BindFunc {
+			calls = append(calls, call{name: obj.Name, owner: string(rc.Owner()), debug: rc.Debug()})
+			return []BindFunc{ScheduleAfter(time.Minute)}
+		},
+		nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "configmap-controller", recorderName)
+
+	result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "cm"}})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, result.RequeueAfter)
+
+	// The force requeue after is kept per request.
+	result, err = r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "debug"}})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, result.RequeueAfter)
+	assert.Zero(t, r.helper.ForceRequeueAfter())
+
+	result, err = r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "missing"}})
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, result)
+
+	assert.Equal(t, []call{
+		{name: "cm", owner: "configmap-controller"},
+		{name: "debug", owner: "configmap-controller", debug: true},
+	}, calls)
+}
+
+func TestReconcilerOptions(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	r, err := newReconciler(NewDefaultReconcileHelper(c, nil, nil, scheme.Scheme),
+		func(name string) record.EventRecorder {
+			assert.Equal(t, "mysql", name)
+			return record.NewFakeRecorder(1)
+		}, logr.Discard(),
+		func() *corev1.ConfigMap { return &corev1.ConfigMap{} },
+		func(rc ReconcileContext, obj *corev1.ConfigMap) []BindFunc { return nil },
+		[]ReconcilerOption{WithReconcilerName("mysql"), WithFieldOwner("mysql-operator")})
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql-operator", string(r.owner))
+}
@@ -0,0 +1,225 @@
+package kube
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// AttemptStore keeps the retry attempts of steps across reconciles.
+type AttemptStore interface {
+	// Increase increases the attempts of the key by one and returns the result.
+	Increase(key string) int
+	// Reset resets the attempts of the key.
+	Reset(key string)
+}
+
+// DefaultAttemptTTL is the default duration the attempts are kept in the memory store
+// since the last attempt.
+const DefaultAttemptTTL = 1 * time.Hour
+
+type attemptEntry struct {
+	attempts int
+	last     time.Time
+}
+
+type memoryAttemptStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	attempts map[string]*attemptEntry
+	swept    time.Time
+}
+
+// sweep evicts the expired attempts, e.g. of the objects deleted, at most once per ttl.
+func (s *memoryAttemptStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < s.ttl {
+		return
+	}
+	s.swept = now
+	for key, e := range s.attempts {
+		if now.Sub(e.last) > s.ttl {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+func (s *memoryAttemptStore) Increase(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	e, ok := s.attempts[key]
+	if !ok || now.Sub(e.last) > s.ttl {
+		e = &attemptEntry{}
+		s.attempts[key] = e
+	}
+	e.attempts++
+	e.last = now
+	return e.attempts
+}
+
+func (s *memoryAttemptStore) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+}
+
+// NewMemoryAttemptStore returns an attempt store keeping the attempts in memory for
+// DefaultAttemptTTL since the last attempt. The attempts are lost when the controller
+// restarts, which is fine for most of the cases.
+func NewMemoryAttemptStore() AttemptStore {
+	return NewMemoryAttemptStoreWithTTL(DefaultAttemptTTL)
+}
+
+// NewMemoryAttemptStoreWithTTL returns a memory attempt store evicting the attempts not
+// increased in ttl, which starts over from the first attempt.
+func NewMemoryAttemptStoreWithTTL(ttl time.Duration) AttemptStore {
+	return &memoryAttemptStore{
+		ttl:      ttl,
+		attempts: make(map[string]*attemptEntry),
+		swept:    time.Now(),
+	}
+}
+
+var defaultAttemptStore = NewMemoryAttemptStore()
+
+// RetryPolicy is an exponential backoff policy for steps ending with Flow.RetryErr.
+type RetryPolicy struct {
+	// InitialInterval is the backoff of the first attempt, defaults to 1s.
+	InitialInterval time.Duration
+	// MaxInterval is the upper bound of the backoff, zero means no bound.
+	MaxInterval time.Duration
+	// Multiplier is the factor the backoff multiplies by per attempt, defaults to 2.
+	Multiplier float64
+	// Jitter is the max fraction of the backoff which is randomly added, e.g. 0.1.
+	Jitter float64
+	// MaxAttempts is the max attempts before escalating to Flow.Error, zero means unlimited.
+	MaxAttempts int
+	// Store keeps the attempts across reconciles, defaults to a process-wide memory store
+	// with DefaultAttemptTTL.
+	Store AttemptStore
+}
+
+func (p *RetryPolicy) store() AttemptStore {
+	if p.Store == nil {
+		return defaultAttemptStore
+	}
+	return p.Store
+}
+
+// Backoff returns the backoff of the given attempt, which starts from 1.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	interval, multiplier := p.InitialInterval, p.Multiplier
+	if interval <= 0 {
+		interval = 1 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	backoff := float64(interval) * math.Pow(multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * rand.Float64()
+	}
+	if p.MaxInterval > 0 && backoff > float64(p.MaxInterval) {
+		return p.MaxInterval
+	}
+	if backoff > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(backoff)
+}
+
+// DefaultRetryPolicy returns a policy starting from 1s and doubling up to 5m with a 10%
+// jitter, which never gives up.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: 1 * time.Second,
+		MaxInterval:     5 * time.Minute,
+		Multiplier:      2,
+		Jitter:          0.1,
+	}
+}
+
+// retryState is the retry state of a step execution, shared by all the flows derived.
+type retryState struct {
+	policy *RetryPolicy
+	key    string
+
+	mu        sync.Mutex
+	retried   bool
+	attempt   int
+	backoff   time.Duration
+	exhausted bool
+}
+
+// next records a new attempt and returns the attempt, the backoff and whether the
+// attempts are exhausted. The attempt is recorded once per execution, e.g. the flows
+// of the steps in Parallel retrying together share it.
+func (s *retryState) next() (int, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.retried {
+		return s.attempt, s.backoff, s.exhausted
+	}
+	s.retried = true
+
+	store := s.policy.store()
+	s.attempt = store.Increase(s.key)
+	if s.policy.MaxAttempts > 0 && s.attempt >= s.policy.MaxAttempts {
+		store.Reset(s.key)
+		s.exhausted = true
+	} else {
+		s.backoff = s.policy.Backoff(s.attempt)
+	}
+	return s.attempt, s.backoff, s.exhausted
+}
+
+func (s *retryState) hasRetried() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.retried
+}
+
+type retryStep struct {
+	Step
+	policy RetryPolicy
+}
+
+func (s *retryStep) Execute(rc ReconcileContext, f Flow) (reconcile.Result, error) {
+	inner, ok := f.(*flow)
+	if !ok {
+		return s.Step.Execute(rc, f)
+	}
+
+	state := &retryState{
+		policy: &s.policy,
+		key:    rc.Request().String() + "/" + s.Step.Name(),
+	}
+	inner = inner.clone()
+	inner.retry = state
+
+	result, err := s.Step.Execute(rc, inner)
+	// Any outcome other than RetryErr resets the attempts.
+	if !state.hasRetried() {
+		s.policy.store().Reset(state.key)
+	}
+	return result, err
+}
+
+// WithRetryPolicy returns a step which retries with the policy when the given step ends
+// with Flow.RetryErr. The attempts are counted per request and step name across
+// reconciles, and the step escalates to Flow.Error once they run out.
+func WithRetryPolicy(step Step, policy RetryPolicy) Step {
+	return &retryStep{
+		Step:   step,
+		policy: policy,
+	}
+}
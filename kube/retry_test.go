@@ -0,0 +1,102 @@
+package kube
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      3,
+	}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 3*time.Second, policy.Backoff(2))
+	assert.Equal(t, 9*time.Second, policy.Backoff(3))
+	assert.Equal(t, 10*time.Second, policy.Backoff(4))
+	assert.Equal(t, 10*time.Second, policy.Backoff(100))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		backoff := policy.Backoff(2)
+		assert.GreaterOrEqual(t, backoff, 3*time.Second)
+		assert.LessOrEqual(t, backoff, 4500*time.Millisecond)
+	}
+}
+
+func TestWithRetryPolicy(t *testing.T) {
+	fail := true
+	step := WithRetryPolicy(NewStep("flaky", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		if fail {
+			return flow.WithLoggerValues("k", "v").RetryErr(errors.New("not ready"), "Not ready.")
+		}
+		return flow.Pass()
+	}), RetryPolicy{
+		InitialInterval: time.Second,
+		MaxAttempts:     3,
+		Store:           NewMemoryAttemptStore(),
+	})
+
+	result, err := runTestTask(NewStepBinder(step))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, result.RequeueAfter)
+
+	result, err = runTestTask(NewStepBinder(step))
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, result.RequeueAfter)
+
+	_, err = runTestTask(NewStepBinder(step))
+	assert.ErrorContains(t, err, "not ready (after 3 attempts)")
+
+	// Starts over after escalation.
+	result, err = runTestTask(NewStepBinder(step))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, result.RequeueAfter)
+
+	// Resets on success.
+	fail = false
+	_, err = runTestTask(NewStepBinder(step))
+	assert.NoError(t, err)
+	fail = true
+	result, err = runTestTask(NewStepBinder(step))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, result.RequeueAfter)
+}
+
+func TestMemoryAttemptStoreTTL(t *testing.T) {
+	store := NewMemoryAttemptStoreWithTTL(20 * time.Millisecond)
+	assert.Equal(t, 1, store.Increase("a"))
+	assert.Equal(t, 2, store.Increase("a"))
+
+	// Expired attempts start over and are evicted.
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, 1, store.Increase("b"))
+	assert.NotContains(t, store.(*memoryAttemptStore).attempts, "a")
+	assert.Equal(t, 1, store.Increase("a"))
+}
+
+func TestWithRetryPolicyParallel(t *testing.T) {
+	flaky := func(name string) Step {
+		return NewStep(name, func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			return flow.RetryErr(errors.New(name+" not ready"), "Not ready.")
+		})
+	}
+	step := WithRetryPolicy(NewParallelStep(flaky("a"), flaky("b"), flaky("c")), RetryPolicy{
+		InitialInterval: time.Second,
+		MaxAttempts:     3,
+		Store:           NewMemoryAttemptStore(),
+	})
+
+	// Attempts are counted once per reconcile.
+	result, err := runTestTask(NewStepBinder(step))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, result.RequeueAfter)
+	result, err = runTestTask(NewStepBinder(step))
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, result.RequeueAfter)
+}
@@ -0,0 +1,95 @@
+package kube
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// setObservedGeneration sets status.observedGeneration of the object to its generation,
+// if the status has such a field. For unstructured objects, it's set if there's a status.
+func setObservedGeneration(object client.Object) {
+	generation := object.GetGeneration()
+	if u, ok := object.(runtime.Unstructured); ok {
+		content := u.UnstructuredContent()
+		if _, found, _ := unstructured.NestedMap(content, "status"); found {
+			_ = unstructured.SetNestedField(content, generation, "status", "observedGeneration")
+		}
+		return
+	}
+
+	v := reflect.ValueOf(object)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	status := v.Elem().FieldByName("Status")
+	if status.Kind() == reflect.Ptr {
+		if status.IsNil() {
+			return
+		}
+		status = status.Elem()
+	}
+	if status.Kind() != reflect.Struct {
+		return
+	}
+	field := status.FieldByName("ObservedGeneration")
+	if field.IsValid() && field.CanSet() && field.Kind() == reflect.Int64 {
+		field.SetInt(generation)
+	}
+}
+
+// mutateStatus mutates the status of the object, and returns the object before the
+// mutation and whether it's changed.
+func mutateStatus(object client.Object, mutate func()) (client.Object, bool) {
+	before := object.DeepCopyObject().(client.Object)
+	if mutate != nil {
+		mutate()
+	}
+	setObservedGeneration(object)
+	return before, !equality.Semantic.DeepEqual(before, object)
+}
+
+// PatchStatus mutates the object and sends the changes as a merge patch to the status
+// subresource, with status.observedGeneration set to the generation of the object. The
+// patch is sent with the optimistic lock, and on conflicts the object is read again and
+// mutated again, so mutate should be idempotent. Nothing is sent if nothing changes.
+func (rc *BaseReconcileContext) PatchStatus(object client.Object, mutate func()) error {
+	first := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := rc.Get(object); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		before, changed := mutateStatus(object, mutate)
+		if !changed {
+			return nil
+		}
+		patch := client.MergeFromWithOptions(before, client.MergeFromWithOptimisticLock{})
+		return rc.Client().Status().Patch(rc.context, object, patch, rc.owner)
+	})
+}
+
+// ApplyStatus sends an apply patch of the object to the status subresource, with
+// status.observedGeneration set to the generation of the object. The fieldManager is
+// set to rc.Owner and the force parameter is true.
+func (rc *BaseReconcileContext) ApplyStatus(object client.Object) error {
+	setObservedGeneration(object)
+
+	// Generate an apply-patch by comparing the object to its zero value.
+	zero := reflect.New(reflect.TypeOf(object).Elem()).Interface()
+	data, err := client.MergeFrom(zero.(client.Object)).Data(object)
+	if err != nil {
+		return err
+	}
+	apply := client.RawPatch(client.Apply.Type(), data)
+	force := &client.SubResourcePatchOptions{PatchOptions: client.PatchOptions{Force: pointer.Bool(true)}}
+	return rc.Client().Status().Patch(rc.context, object, apply, rc.owner, force)
+}
@@ -0,0 +1,44 @@
+package kube_test
+
+import (
+	"testing"
+
+	"github.com/sqc157400661/helper/kube/kubetest"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPatchStatusRetriesOnConflict(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithObjects(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Generation: 2},
+	}))
+
+	stale := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	assert.NoError(t, rc.Get(stale))
+
+	// Someone else changes the object in the meantime.
+	live := stale.DeepCopy()
+	live.Labels = map[string]string{"a": "b"}
+	assert.NoError(t, rc.Client().Update(rc.Context(), live))
+
+	mutations := 0
+	assert.NoError(t, rc.PatchStatus(stale, func() {
+		mutations++
+		stale.Status.Replicas = 3
+	}))
+	assert.Equal(t, 2, mutations)
+
+	actual := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	assert.NoError(t, rc.Get(actual))
+	assert.Equal(t, int32(3), actual.Status.Replicas)
+	assert.Equal(t, int64(2), actual.Status.ObservedGeneration)
+	assert.Equal(t, map[string]string{"a": "b"}, actual.Labels)
+
+	// Nothing is sent when nothing changes.
+	writes := len(rc.Writes())
+	assert.NoError(t, rc.PatchStatus(actual, func() {
+		actual.Status.Replicas = 3
+	}))
+	assert.Len(t, rc.Writes(), writes)
+}
@@ -0,0 +1,134 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ErrStepTimeout is the error reported by Flow.RetryErr when a step exceeds its deadline.
+var ErrStepTimeout = errors.New("step timeout")
+
+type contextBinder interface {
+	// WithContext returns a copy of the reconcile context bound to the given context.
+	WithContext(ctx context.Context) ReconcileContext
+}
+
+type boundReconcileContext struct {
+	ReconcileContext
+	ctx context.Context
+}
+
+func (rc *boundReconcileContext) Context() context.Context {
+	return rc.ctx
+}
+
+// withContext binds the reconcile context to ctx. Reconcile contexts implementing
+// WithContext are copied by themselves, otherwise only the Context method is overridden.
+func withContext(rc ReconcileContext, ctx context.Context) ReconcileContext {
+	if b, ok := rc.(contextBinder); ok {
+		return b.WithContext(ctx)
+	}
+	return &boundReconcileContext{ReconcileContext: rc, ctx: ctx}
+}
+
+// executeWithTimeout executes the step with a context derived from rc.Context() and
+// the given timeout, which is cancelled once it returns. The step is executed in a
+// separated goroutine on a forked flow and a copy of the reconcile context, so a step
+// ignoring the context could never block the reconcile beyond the deadline. When the
+// deadline exceeds, it ends with Flow.RetryErr and an error wrapping ErrStepTimeout, and
+// the step is abandoned: its outcome is dropped, and it never counts the attempts of the
+// retry policies, traces, reports conditions or emits events. However, it can't be stopped, so steps must honour rc.Context() and
+// return once it's done, otherwise they keep running, e.g. writing objects, after the
+// deadline.
+func executeWithTimeout(rc ReconcileContext, f Flow, step Step, timeout time.Duration) (reconcile.Result, error) {
+	parent := rc.Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// The forked flow and context must be created before, as they are reused by
+	// following steps.
+	child := forkFlow(f, f.Logger())
+	childRC := withContext(rc, ctx)
+	ch := make(chan childOutcome, 1)
+	go func() {
+		ch <- runChild(childRC, child, step)
+	}()
+
+	var err error
+	select {
+	case o := <-ch:
+		if o.panicked != nil {
+			panic(o.panicked)
+		}
+		if inner, ok := f.(*flow); ok {
+			inner.merge(child)
+		}
+		return o.result, o.err
+	case <-timer.C:
+		err = fmt.Errorf("%w: %s exceeded %s", ErrStepTimeout, step.Name(), timeout)
+	case <-parent.Done():
+		err = parent.Err()
+	}
+
+	// Abandon the step before cancelling its context.
+	child.state.abandoned.Store(true)
+	cancel()
+	return f.RetryErr(err, "Step not finished in time.", "timeout", timeout)
+}
+
+type timeoutStep struct {
+	Step
+	timeout time.Duration
+}
+
+func (s *timeoutStep) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	if s.timeout <= 0 {
+		return s.Step.Execute(rc, flow)
+	}
+	return executeWithTimeout(rc, flow, s.Step, s.timeout)
+}
+
+// NewStepWithTimeout returns a step executing the given one with its own timeout, which
+// overrides the default one set by WithStepTimeout. A non-positive timeout disables it.
+// The timeout of a step with WithRetryPolicy is applied to each attempt, so the timeouts
+// are retried with the backoff of the policy. The step must honour rc.Context(), see
+// executeWithTimeout.
+func NewStepWithTimeout(step Step, timeout time.Duration) Step {
+	if s, ok := step.(*retryStep); ok {
+		return &retryStep{Step: NewStepWithTimeout(s.Step, timeout), policy: s.policy}
+	}
+	return &timeoutStep{
+		Step:    step,
+		timeout: timeout,
+	}
+}
+
+// hasTimeout returns true if the step has its own timeout.
+func hasTimeout(step Step) bool {
+	switch s := step.(type) {
+	case *timeoutStep:
+		return true
+	case *retryStep:
+		return hasTimeout(s.Step)
+	default:
+		return false
+	}
+}
+
+// Timeout binds the steps of the binders with the given timeout. See NewStepWithTimeout.
+func Timeout(timeout time.Duration, binders ...BindFunc) BindFunc {
+	return func(t *Task, deferred ...bool) {
+		for _, step := range ExtractStepsFromBindFunc(binders...) {
+			NewStepBinder(NewStepWithTimeout(step, timeout))(t, deferred...)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package kube
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func hangingStep(name string) BindFunc {
+	return NewStepBinder(NewStep(name, func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		<-rc.Context().Done()
+		time.Sleep(50 * time.Millisecond)
+		return flow.Wait("Should be ignored.")
+	}))
+}
+
+func TestStepTimeout(t *testing.T) {
+	executed := false
+	result, err := runTestTaskWithOptions(
+		[]ExecutorOption{WithStepTimeout(10 * time.Millisecond)},
+		hangingStep("hang"),
+		NewStepBinder(NewStep("after", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			executed = true
+			return flow.Pass()
+		})),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, result.RequeueAfter)
+	assert.False(t, executed, "flow should break after timeout")
+}
+
+func TestStepTimeoutOverride(t *testing.T) {
+	deferredExecuted := false
+	result, err := runTestTaskWithOptions(
+		[]ExecutorOption{WithStepTimeout(time.Hour)},
+		Timeout(10*time.Millisecond, hangingStep("hang")),
+		func(task *Task, deferred ...bool) {
+			NewStepBinder(NewStep("deferred", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+				assert.NoError(t, rc.Context().Err())
+				deferredExecuted = true
+				return flow.Pass()
+			}))(task, true)
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, result.RequeueAfter)
+	assert.True(t, deferredExecuted)
+}
+
+func TestStepWithinTimeout(t *testing.T) {
+	result, err := runTestTaskWithOptions(
+		[]ExecutorOption{WithStepTimeout(time.Second)},
+		RetryAfter(5*time.Second, "Retry."),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, result.RequeueAfter)
+}
+
+func TestStepTimeoutWithRetryPolicy(t *testing.T) {
+	abandoned := make(chan struct{})
+	step := WithRetryPolicy(NewStep("hang", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		<-rc.Context().Done()
+		defer close(abandoned)
+		// Abandoned steps never count the attempts.
+		return flow.RetryErr(rc.Context().Err(), "Cancelled.")
+	}), RetryPolicy{
+		InitialInterval: 3 * time.Second,
+		MaxAttempts:     2,
+		Store:           NewMemoryAttemptStore(),
+	})
+	opts := []ExecutorOption{WithStepTimeout(10 * time.Millisecond)}
+
+	// Timeouts are retried with the backoff of the policy.
+	result, err := runTestTaskWithOptions(opts, NewStepBinder(step))
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Second, result.RequeueAfter)
+	<-abandoned
+
+	abandoned = make(chan struct{})
+	_, err = runTestTaskWithOptions(opts, NewStepBinder(step))
+	assert.ErrorIs(t, err, ErrStepTimeout)
+	assert.ErrorContains(t, err, "after 2 attempts")
+	<-abandoned
+}
+
+type statusReconcileContext struct {
+	recorderReconcileContext
+}
+
+func (rc *statusReconcileContext) PatchStatus(object client.Object, mutate func()) error {
+	mutate()
+	return nil
+}
+
+func TestStepTimeoutAbandonedSideEffects(t *testing.T) {
+	abandoned := make(chan struct{})
+	late := &block{name: "late", binders: []BindFunc{
+		NewStepBinder(NewStep("hang", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			<-rc.Context().Done()
+			return flow.Pass()
+		})),
+		Milestone("Synced", "Synced.", NewStepBinder(NewStep("sync", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			return flow.Pass()
+		}))),
+		ReportsCondition("Ready", NewStepBinder(NewStep("fail", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			defer close(abandoned)
+			return flow.Error(errors.New("boom"), "Failed.")
+		}))),
+	}}
+	task := NewTask()
+	NewStepBinder(NewStepWithTimeout(late, 10*time.Millisecond))(task)
+
+	obj := &testObjectWithConditions{}
+	recorder := record.NewFakeRecorder(16)
+	exec := NewExecutor(logr.Discard(), WithEvents(&corev1.ConfigMap{}), WithStatusConditions(obj))
+	_, err := exec.Execute(&statusReconcileContext{recorderReconcileContext{recorder: recorder}}, task)
+	assert.NoError(t, err)
+	<-abandoned
+
+	// Only the timeout is reported, the abandoned step emits no events and reports no
+	// conditions after that.
+	close(recorder.Events)
+	var events []string
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+	assert.Equal(t, []string{"Warning StepFailed Step late failed: step timeout: late exceeded 10ms"}, events)
+	assert.Empty(t, exec.(*executor).conditions.conditions)
+	assert.Empty(t, obj.GetConditions())
+}
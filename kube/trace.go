@@ -1,10 +1,125 @@
 package kube
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outcome is the outcome of a step or an executor run.
+type Outcome string
+
+const (
+	OutcomeContinue Outcome = "CONTINUE"
+	OutcomeBreak    Outcome = "BREAK"
+	OutcomeError    Outcome = "ERROR"
+	OutcomeComplete Outcome = "COMPLETE"
+)
+
+// SpanKind is the kind of operation a span records.
+type SpanKind string
+
+const (
+	SpanKindReconcile    SpanKind = "reconcile"
+	SpanKindStep         SpanKind = "step"
+	SpanKindDeferredStep SpanKind = "deferred-step"
+	SpanKindCondition    SpanKind = "condition"
+)
+
+// Span records a timed operation in an executor run.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Outcome    Outcome
+	Err        error
+	Attributes map[string]interface{}
+}
+
+// Duration returns the duration of the span.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Trace is the record of an executor run. The first span is the root span of the
+// reconcile, and a parent span always comes before its children.
+type Trace struct {
+	ID    string
+	Spans []Span
+}
+
+// Root returns the root span.
+func (t *Trace) Root() *Span {
+	if len(t.Spans) == 0 {
+		return nil
+	}
+	return &t.Spans[0]
+}
+
+// Children returns the direct children of the span with the given id.
+func (t *Trace) Children(spanID string) []Span {
+	children := make([]Span, 0)
+	for _, s := range t.Spans {
+		if s.ParentID == spanID {
+			children = append(children, s)
+		}
+	}
+	return children
+}
+
+// TraceExporter exports the trace of every executor run.
+type TraceExporter interface {
+	ExportTrace(ctx context.Context, trace *Trace) error
+}
+
+// InMemoryExporter keeps the exported traces in memory, which is useful in tests.
+type InMemoryExporter struct {
+	mu     sync.Mutex
+	traces []*Trace
+}
+
+func (e *InMemoryExporter) ExportTrace(ctx context.Context, trace *Trace) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.traces = append(e.traces, trace)
+	return nil
+}
+
+// Traces returns the exported traces.
+func (e *InMemoryExporter) Traces() []*Trace {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]*Trace(nil), e.traces...)
+}
+
+// Reset drops the exported traces.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.traces = nil
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
 
 type tracer struct {
 	stepIndex int
 	id        string
+
+	mu     sync.Mutex
+	spans  []*Span
+	nextID int
 }
 
 func (t *tracer) currentStepIndex() int {
@@ -15,6 +130,94 @@ func (t *tracer) markStepDone() {
 	t.stepIndex++
 }
 
+// startSpan starts a span under the parent, or a root span if parent is nil. It's safe
+// to be invoked on a nil tracer, which returns a nil span.
+func (t *tracer) startSpan(parent *Span, name string, kind SpanKind, kvs ...interface{}) *Span {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	span := &Span{
+		TraceID:    t.id,
+		SpanID:     strconv.Itoa(t.nextID),
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+	if parent != nil {
+		span.ParentID = parent.SpanID
+	}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if k, ok := kvs[i].(string); ok {
+			span.Attributes[k] = kvs[i+1]
+		}
+	}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+// endSpan ends the span with the outcome and error. It's safe to be invoked with nils.
+func (t *tracer) endSpan(span *Span, outcome Outcome, err error, kvs ...interface{}) {
+	if t == nil || span == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	span.End = time.Now()
+	span.Outcome = outcome
+	span.Err = err
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if k, ok := kvs[i].(string); ok {
+			span.Attributes[k] = kvs[i+1]
+		}
+	}
+}
+
+// trace returns a snapshot of the recorded spans.
+func (t *tracer) trace() *Trace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := make([]Span, 0, len(t.spans))
+	for _, s := range t.spans {
+		span := *s
+		span.Attributes = make(map[string]interface{}, len(s.Attributes))
+		for k, v := range s.Attributes {
+			span.Attributes[k] = v
+		}
+		spans = append(spans, span)
+	}
+	return &Trace{
+		ID:    t.id,
+		Spans: spans,
+	}
+}
+
+// traceCondition starts a span of evaluating the condition under the current span of
+// the flow, and returns a function to end it with the evaluation result.
+func traceCondition(f Flow, name string) func(bool, error) {
+	inner, ok := f.(*flow)
+	if !ok || inner.tracer == nil {
+		return func(bool, error) {}
+	}
+
+	span := inner.activeTracer().startSpan(inner.span, name, SpanKindCondition)
+	return func(result bool, err error) {
+		outcome := OutcomeContinue
+		if err != nil {
+			outcome = OutcomeError
+		}
+		inner.activeTracer().endSpan(span, outcome, err, "result", result)
+	}
+}
+
 func newTracer() *tracer {
 	return &tracer{
 		stepIndex: 0,
@@ -0,0 +1,84 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+type otelExporter struct {
+	tracer oteltrace.Tracer
+}
+
+func (e *otelExporter) ExportTrace(ctx context.Context, trace *Trace) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Parents always come before children, so their contexts are ready.
+	contexts := make(map[string]context.Context, len(trace.Spans))
+	spans := make([]oteltrace.Span, 0, len(trace.Spans))
+	for _, s := range trace.Spans {
+		parent, ok := contexts[s.ParentID]
+		if !ok {
+			parent = ctx
+		}
+
+		attrs := []attribute.KeyValue{
+			attribute.String("kube.trace_id", s.TraceID),
+			attribute.String("kube.span_kind", string(s.Kind)),
+			attribute.String("kube.outcome", string(s.Outcome)),
+		}
+		for k, v := range s.Attributes {
+			attrs = append(attrs, otelAttribute(k, v))
+		}
+
+		spanCtx, span := e.tracer.Start(parent, s.Name,
+			oteltrace.WithTimestamp(s.Start),
+			oteltrace.WithAttributes(attrs...),
+		)
+		if s.Err != nil {
+			span.RecordError(s.Err, oteltrace.WithTimestamp(s.End))
+			span.SetStatus(codes.Error, s.Err.Error())
+		}
+		contexts[s.SpanID] = spanCtx
+		spans = append(spans, span)
+	}
+
+	for i, span := range spans {
+		span.End(oteltrace.WithTimestamp(trace.Spans[i].End))
+	}
+	return nil
+}
+
+func otelAttribute(k string, v interface{}) attribute.KeyValue {
+	switch v := v.(type) {
+	case string:
+		return attribute.String(k, v)
+	case bool:
+		return attribute.Bool(k, v)
+	case int:
+		return attribute.Int(k, v)
+	case int64:
+		return attribute.Int64(k, v)
+	case float64:
+		return attribute.Float64(k, v)
+	case time.Duration:
+		return attribute.String(k, v.String())
+	default:
+		return attribute.String(k, fmt.Sprintf("%v", v))
+	}
+}
+
+// NewOpenTelemetryExporter returns an exporter replaying the spans of every trace with
+// the given OpenTelemetry tracer, keeping their timestamps and hierarchy. The root span
+// is a child of the span in the reconcile context, if there's any.
+func NewOpenTelemetryExporter(tracer oteltrace.Tracer) TraceExporter {
+	return &otelExporter{
+		tracer: tracer,
+	}
+}
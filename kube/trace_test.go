@@ -0,0 +1,53 @@
+package kube
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestExecutorTrace(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	task := NewTask()
+	NewStepIfBinder(
+		NewCondition("always", func(rc ReconcileContext, log logr.Logger) (bool, error) {
+			return true, nil
+		}),
+		NewStep("retry", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+			return flow.RetryErr(errors.New("not ready"), "Not ready.")
+		}),
+	)(task)
+	Wait("unreachable")(task)
+	NewStepBinder(NewStep("cleanup", func(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+		return flow.Pass()
+	}))(task, true)
+
+	_, err := NewExecutor(logr.Discard(), WithTraceExporter(exporter)).Execute(&testReconcileContext{}, task)
+	assert.NoError(t, err)
+
+	traces := exporter.Traces()
+	assert.Len(t, traces, 1)
+	trace := traces[0]
+
+	root := trace.Root()
+	assert.Equal(t, SpanKindReconcile, root.Kind)
+	assert.Equal(t, OutcomeBreak, root.Outcome)
+
+	children := trace.Children(root.SpanID)
+	assert.Len(t, children, 2)
+	assert.Equal(t, SpanKindStep, children[0].Kind)
+	assert.Equal(t, OutcomeError, children[0].Outcome)
+	assert.EqualError(t, children[0].Err, "not ready")
+	assert.Equal(t, "cleanup", children[1].Name)
+	assert.Equal(t, SpanKindDeferredStep, children[1].Kind)
+	assert.Equal(t, OutcomeComplete, children[1].Outcome)
+
+	conds := trace.Children(children[0].SpanID)
+	assert.Len(t, conds, 1)
+	assert.Equal(t, "always", conds[0].Name)
+	assert.Equal(t, SpanKindCondition, conds[0].Kind)
+	assert.Equal(t, true, conds[0].Attributes["result"])
+}
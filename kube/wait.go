@@ -0,0 +1,315 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DefaultWaitInterval is the default interval to check the workloads again.
+const DefaultWaitInterval = 5 * time.Second
+
+var (
+	// ErrWaitDeadlineExceeded is returned when the workload isn't ready before the deadline.
+	ErrWaitDeadlineExceeded = errors.New("wait deadline exceeded")
+	// ErrWorkloadFailed is returned when the workload fails and would never be ready, e.g.
+	// a failed Job.
+	ErrWorkloadFailed = errors.New("workload failed")
+)
+
+// waitIdleTimeout is the min duration the start of a wait is kept since its last check.
+const waitIdleTimeout = 1 * time.Hour
+
+type waitEntry struct {
+	started time.Time
+	checked time.Time
+	idle    time.Duration
+}
+
+// waitTracker keeps the time when the waits start across reconciles in memory. The
+// waits not checked for a while, e.g. of the objects deleted, are evicted.
+type waitTracker struct {
+	mu      sync.Mutex
+	entries map[string]*waitEntry
+	swept   time.Time
+}
+
+// start returns the start of the wait, and keeps it until it's not checked in idle.
+func (t *waitTracker) start(key string, idle time.Duration) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweep(now)
+	e, ok := t.entries[key]
+	if !ok {
+		e = &waitEntry{started: now}
+		t.entries[key] = e
+	}
+	e.checked, e.idle = now, idle
+	return e.started
+}
+
+func (t *waitTracker) sweep(now time.Time) {
+	if now.Sub(t.swept) < waitIdleTimeout {
+		return
+	}
+	t.swept = now
+	for key, e := range t.entries {
+		if now.Sub(e.checked) > e.idle {
+			delete(t.entries, key)
+		}
+	}
+}
+
+func (t *waitTracker) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, key)
+}
+
+var defaultWaitTracker = &waitTracker{entries: make(map[string]*waitEntry), swept: time.Now()}
+
+// readyFunc checks if the workload is ready, and returns the progress to be logged. It
+// returns an error wrapping ErrWorkloadFailed if the workload would never be ready.
+type readyFunc func(rc ReconcileContext) (ready bool, progress []interface{}, err error)
+
+type waitStep struct {
+	name     string
+	ready    readyFunc
+	interval time.Duration
+	deadline time.Duration
+}
+
+// WaitOption is an option of the wait binders, e.g. WaitForDeploymentAvailable.
+type WaitOption func(s *waitStep)
+
+// WaitInterval sets the interval to check the workload again, defaults to
+// DefaultWaitInterval.
+func WaitInterval(interval time.Duration) WaitOption {
+	return func(s *waitStep) {
+		s.interval = interval
+	}
+}
+
+// WaitDeadline fails the wait with ErrWaitDeadlineExceeded if the workload isn't ready
+// in the duration since the first check. The start is kept in memory per request, and
+// is reset once the workload is ready, the wait fails, or it's not checked for an hour
+// or ten intervals, whichever is longer. As it's not persisted, the deadline starts over
+// when the controller restarts or another replica takes over, so it bounds the wait in
+// a process rather than in total.
+func WaitDeadline(deadline time.Duration) WaitOption {
+	return func(s *waitStep) {
+		s.deadline = deadline
+	}
+}
+
+func (s *waitStep) Name() string {
+	return s.name
+}
+
+func (s *waitStep) Execute(rc ReconcileContext, flow Flow) (reconcile.Result, error) {
+	key := rc.Request().String() + "/" + s.name
+
+	ready, progress, err := s.ready(rc)
+	if errors.Is(err, ErrWorkloadFailed) {
+		defaultWaitTracker.reset(key)
+		return flow.Error(err, "Workload failed.", progress...)
+	}
+	if err != nil {
+		return flow.RetryErr(err, "Failed to check workload.", progress...)
+	}
+	if ready {
+		defaultWaitTracker.reset(key)
+		return flow.Continue("Workload is ready.", progress...)
+	}
+
+	idle := 10 * s.interval
+	if idle < waitIdleTimeout {
+		idle = waitIdleTimeout
+	}
+	started := defaultWaitTracker.start(key, idle)
+	if s.deadline > 0 && time.Since(started) > s.deadline {
+		defaultWaitTracker.reset(key)
+		return flow.Error(fmt.Errorf("%w: %s not ready in %s", ErrWaitDeadlineExceeded, s.name, s.deadline),
+			"Workload is not ready before the deadline.", progress...)
+	}
+	return flow.RetryAfter(s.interval, "Waiting for workload.", progress...)
+}
+
+func newWaitBinder(name string, ready readyFunc, opts []WaitOption) BindFunc {
+	s := &waitStep{name: name, ready: ready, interval: DefaultWaitInterval}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return NewStepBinder(s)
+}
+
+// getWorkload gets the workload in the namespace of the context, and returns false if
+// it's not found.
+func getWorkload(rc ReconcileContext, name string, obj client.Object) (bool, error) {
+	obj.SetName(name)
+	obj.SetNamespace(rc.Namespace())
+	err := rc.Get(obj)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// WaitForDeploymentAvailable waits for the Deployment in the namespace of the context to
+// be rolled out, i.e. all the replicas are updated and available and no old replicas are
+// left, like kubectl rollout status. It fails if the rollout exceeds its progress deadline.
+func WaitForDeploymentAvailable(name string, opts ...WaitOption) BindFunc {
+	return newWaitBinder("WaitForDeploymentAvailable("+name+")", func(rc ReconcileContext) (bool, []interface{}, error) {
+		progress := []interface{}{"deployment", name}
+		deploy := &appsv1.Deployment{}
+		if found, err := getWorkload(rc, name, deploy); !found {
+			return false, append(progress, "found", false), err
+		}
+
+		replicas := replicasOrDefault(deploy.Spec.Replicas)
+		status := deploy.Status
+		progress = append(progress, "replicas", replicas, "updated", status.UpdatedReplicas,
+			"available", status.AvailableReplicas, "total", status.Replicas)
+
+		if status.ObservedGeneration < deploy.Generation {
+			return false, progress, nil
+		}
+		for _, c := range status.Conditions {
+			if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+				return false, progress, fmt.Errorf("%w: deployment %s: %s", ErrWorkloadFailed, name, c.Message)
+			}
+		}
+		return status.UpdatedReplicas >= replicas && status.Replicas <= status.UpdatedReplicas &&
+			status.AvailableReplicas >= status.UpdatedReplicas, progress, nil
+	}, opts)
+}
+
+// WaitForStatefulSetRollout waits for the StatefulSet in the namespace of the context to
+// be rolled out, like kubectl rollout status: all the replicas are ready, and the ones
+// beyond the partition of the rolling update are updated, or the current revision is the
+// update revision if there's no partition.
+func WaitForStatefulSetRollout(name string, opts ...WaitOption) BindFunc {
+	return newWaitBinder("WaitForStatefulSetRollout("+name+")", func(rc ReconcileContext) (bool, []interface{}, error) {
+		progress := []interface{}{"statefulset", name}
+		sts := &appsv1.StatefulSet{}
+		if found, err := getWorkload(rc, name, sts); !found {
+			return false, append(progress, "found", false), err
+		}
+
+		replicas := replicasOrDefault(sts.Spec.Replicas)
+		status := sts.Status
+		progress = append(progress, "replicas", replicas, "ready", status.ReadyReplicas,
+			"updated", status.UpdatedReplicas, "revision", status.CurrentRevision, "update-revision", status.UpdateRevision)
+
+		if status.ObservedGeneration < sts.Generation || status.ReadyReplicas < replicas {
+			return false, progress, nil
+		}
+		strategy := sts.Spec.UpdateStrategy
+		if strategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+			// The pods are only updated when deleted by others.
+			return true, progress, nil
+		}
+		if strategy.RollingUpdate != nil && strategy.RollingUpdate.Partition != nil && *strategy.RollingUpdate.Partition > 0 {
+			partition := *strategy.RollingUpdate.Partition
+			return status.UpdatedReplicas >= replicas-partition, append(progress, "partition", partition), nil
+		}
+		return status.UpdateRevision == status.CurrentRevision, progress, nil
+	}, opts)
+}
+
+// WaitForPodsReady waits for at least n pods matching the selector in the namespace of the
+// context to be ready. Pods being deleted are not counted.
+func WaitForPodsReady(selector labels.Selector, n int, opts ...WaitOption) BindFunc {
+	return newWaitBinder("WaitForPodsReady("+selector.String()+")", func(rc ReconcileContext) (bool, []interface{}, error) {
+		progress := []interface{}{"selector", selector.String(), "desired", n}
+		pods := &corev1.PodList{}
+		if err := rc.List(pods, selector); err != nil {
+			return false, progress, err
+		}
+
+		ready := 0
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.DeletionTimestamp == nil && podReady(pod) {
+				ready++
+			}
+		}
+		return ready >= n, append(progress, "ready", ready, "total", len(pods.Items)), nil
+	}, opts)
+}
+
+// WaitForJobComplete waits for the Job in the namespace of the context to complete, and
+// fails once the Job fails.
+func WaitForJobComplete(name string, opts ...WaitOption) BindFunc {
+	return newWaitBinder("WaitForJobComplete("+name+")", func(rc ReconcileContext) (bool, []interface{}, error) {
+		progress := []interface{}{"job", name}
+		job := &batchv1.Job{}
+		if found, err := getWorkload(rc, name, job); !found {
+			return false, append(progress, "found", false), err
+		}
+
+		status := job.Status
+		progress = append(progress, "active", status.Active, "succeeded", status.Succeeded, "failed", status.Failed)
+		for _, c := range status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch c.Type {
+			case batchv1.JobComplete:
+				return true, progress, nil
+			case batchv1.JobFailed:
+				return false, progress, fmt.Errorf("%w: job %s: %s: %s", ErrWorkloadFailed, name, c.Reason, c.Message)
+			}
+		}
+		return false, progress, nil
+	}, opts)
+}
+
+// WaitForPVCBound waits for the PersistentVolumeClaim in the namespace of the context to
+// be bound, and fails once it's lost.
+func WaitForPVCBound(name string, opts ...WaitOption) BindFunc {
+	return newWaitBinder("WaitForPVCBound("+name+")", func(rc ReconcileContext) (bool, []interface{}, error) {
+		progress := []interface{}{"pvc", name}
+		pvc := &corev1.PersistentVolumeClaim{}
+		if found, err := getWorkload(rc, name, pvc); !found {
+			return false, append(progress, "found", false), err
+		}
+
+		progress = append(progress, "phase", pvc.Status.Phase)
+		switch pvc.Status.Phase {
+		case corev1.ClaimBound:
+			return true, progress, nil
+		case corev1.ClaimLost:
+			return false, progress, fmt.Errorf("%w: pvc %s is lost", ErrWorkloadFailed, name)
+		}
+		return false, progress, nil
+	}, opts)
+}
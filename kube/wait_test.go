@@ -0,0 +1,118 @@
+package kube_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sqc157400661/helper/kube"
+	"github.com/sqc157400661/helper/kube/kubetest"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/pointer"
+)
+
+func TestWaitForDeploymentAvailable(t *testing.T) {
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(3)},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 3,
+		},
+	}
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "app"), kubetest.WithObjects(deploy))
+
+	// An old replica is left.
+	kubetest.Run(t, rc, kube.WaitForDeploymentAvailable("web", kube.WaitInterval(time.Second))).
+		ExpectRequeueAfter(time.Second)
+
+	deploy.Status.Replicas = 3
+	assert.NoError(t, rc.Client().Status().Update(rc.Context(), deploy))
+	kubetest.Run(t, rc, kube.WaitForDeploymentAvailable("web")).ExpectContinue()
+
+	// Not found yet.
+	kubetest.Run(t, rc, kube.WaitForDeploymentAvailable("api")).ExpectRequeueAfter(kube.DefaultWaitInterval)
+}
+
+func TestWaitForStatefulSetRollout(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: pointer.Int32(3),
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: pointer.Int32(2)},
+			},
+		},
+		Status: appsv1.StatefulSetStatus{
+			ReadyReplicas: 3, UpdatedReplicas: 1, CurrentRevision: "db-1", UpdateRevision: "db-2",
+		},
+	}
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "db"), kubetest.WithObjects(sts))
+
+	// The replicas beyond the partition are updated.
+	kubetest.Run(t, rc, kube.WaitForStatefulSetRollout("db")).ExpectContinue()
+
+	sts.Spec.UpdateStrategy.RollingUpdate = nil
+	assert.NoError(t, rc.Client().Update(rc.Context(), sts))
+	kubetest.Run(t, rc, kube.WaitForStatefulSetRollout("db")).ExpectRequeueAfter(kube.DefaultWaitInterval)
+}
+
+func TestWaitForPodsReady(t *testing.T) {
+	pod := func(name string, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "db"}},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: ready},
+			}},
+		}
+	}
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "db"),
+		kubetest.WithObjects(pod("db-0", corev1.ConditionTrue), pod("db-1", corev1.ConditionFalse)))
+
+	selector := labels.SelectorFromSet(labels.Set{"app": "db"})
+	kubetest.Run(t, rc, kube.WaitForPodsReady(selector, 1)).ExpectContinue()
+	kubetest.Run(t, rc, kube.WaitForPodsReady(selector, 2)).ExpectRequeueAfter(kube.DefaultWaitInterval)
+}
+
+func TestWaitForJobComplete(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "backup"), kubetest.WithObjects(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "done", Namespace: "default"},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+			}},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "failed", Namespace: "default"},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"},
+			}},
+		},
+	))
+
+	kubetest.Run(t, rc, kube.WaitForJobComplete("done")).ExpectContinue()
+	err := kubetest.Run(t, rc, kube.WaitForJobComplete("failed")).ExpectError().Err
+	assert.ErrorIs(t, err, kube.ErrWorkloadFailed)
+}
+
+func TestWaitForPVCBoundDeadline(t *testing.T) {
+	rc := kubetest.NewReconcileContext(kubetest.WithRequest("default", "data"), kubetest.WithObjects(
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		},
+	))
+
+	wait := kube.WaitForPVCBound("data", kube.WaitDeadline(20*time.Millisecond))
+	kubetest.Run(t, rc, wait).ExpectRequeueAfter(kube.DefaultWaitInterval)
+	time.Sleep(30 * time.Millisecond)
+	err := kubetest.Run(t, rc, wait).ExpectError().Err
+	assert.ErrorIs(t, err, kube.ErrWaitDeadlineExceeded)
+
+	// The deadline is reset after the failure.
+	kubetest.Run(t, rc, wait).ExpectRequeueAfter(kube.DefaultWaitInterval)
+}